@@ -0,0 +1,134 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type alertmanagerNotifier struct {
+	alertsURL      string
+	headers        map[string]string
+	resolveTimeout time.Duration
+	client         *http.Client
+}
+
+// Alertmanager API v2 alert
+// See: https://github.com/prometheus/alertmanager/blob/main/api/v2/openapi.yaml
+type alertmanagerAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     string            `json:"startsAt,omitempty"`
+	EndsAt       string            `json:"endsAt,omitempty"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+// alertmanagerAlertNames are the 'alertname' labels of the alert types
+var alertmanagerAlertNames = map[alertType]string{
+	containerAlert:         "ContainerNotRunning",
+	healthAlert:            "ContainerUnhealthy",
+	restartAlert:           "ContainerRestartLoop",
+	daemonAlert:            "DockerDaemonUnreachable",
+	containerResourceAlert: "ContainerResourceThreshold",
+	systemAlert:            "SystemResourceThreshold",
+	errorAlert:             "AdmonError",
+}
+
+func newAlertmanagerNotifier(config adMonConfig) (notifier, error) {
+	am := config.Alertmanager
+	if strings.TrimSpace(am.URL) == "" {
+		return nil, errors.New("the 'alertmanager.url' property is empty")
+	}
+
+	// The firing alerts are re-sent on every check, Alertmanager resolves them if admon stops sending
+	resolveTimeout := am.ResolveTimeout
+	if resolveTimeout == 0 {
+		resolveTimeout = config.CheckInterval
+		if config.SysConfig.CheckInterval > resolveTimeout {
+			resolveTimeout = config.SysConfig.CheckInterval
+		}
+		resolveTimeout *= 3
+	}
+
+	return &alertmanagerNotifier{
+		alertsURL:      strings.TrimSuffix(am.URL, "/") + "/api/v2/alerts",
+		headers:        am.Headers,
+		resolveTimeout: time.Duration(resolveTimeout) * time.Second,
+		client:         &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (a *alertmanagerNotifier) name() string {
+	return "alertmanager"
+}
+
+func (a *alertmanagerNotifier) notify(n notification) error {
+	return postJSON(a.client, a.alertsURL, buildAlertmanagerAlerts(n, a.resolveTimeout), a.headers)
+}
+
+// refresh keeps the snoozed alerts firing in Alertmanager, which does the grouping & silencing on its own
+func (a *alertmanagerNotifier) refresh(n notification) error {
+	return a.notify(n)
+}
+
+func buildAlertmanagerAlerts(n notification, resolveTimeout time.Duration) []alertmanagerAlert {
+	keys, descriptions := n.Keys, n.Items
+	if len(keys) == 0 {
+		keys = []string{""}
+		descriptions = []string{n.ErrorMessage}
+	}
+
+	endsAt := n.Time.Add(resolveTimeout)
+	if n.State == alertResolved {
+		endsAt = n.Time
+	}
+
+	alerts := []alertmanagerAlert{}
+	for i, key := range keys {
+		alert := alertmanagerAlert{
+			Labels: alertmanagerLabels(n, key),
+			Annotations: map[string]string{
+				"summary":     n.title(),
+				"description": strings.TrimSpace(descriptions[i]),
+			},
+			EndsAt: endsAt.UTC().Format(time.RFC3339),
+		}
+		if n.State != alertResolved {
+			alert.StartsAt = n.Time.UTC().Format(time.RFC3339)
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+// alertmanagerLabels identifies the alert of an item, so the same container / resource always maps to the same alert
+func alertmanagerLabels(n notification, key string) map[string]string {
+	labels := map[string]string{
+		"alertname":  alertmanagerAlertNames[n.Type],
+		"alert_type": string(n.Type),
+		"host":       n.Host,
+		"instance":   n.APMServerIP,
+		"severity":   n.severity(),
+		"job":        "admon",
+	}
+
+	for field, value := range itemFields(n, key) {
+		labels[field] = value
+	}
+	return labels
+}
@@ -0,0 +1,197 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+type containerStats struct {
+	cpuUsagePercentage float64
+	memUsagePercentage float64
+	memUsage           uint64
+	memLimit           uint64
+}
+
+const defaultRestartWindow = 3600
+
+// restartWindow is the window in seconds the restarts of the container are counted in
+func (t containerThreshold) restartWindow() int {
+	if t.RestartWindow > 0 {
+		return t.RestartWindow
+	}
+	return defaultRestartWindow
+}
+
+// newResourceRestartTracker returns the tracker counting the restarts of the containers with a 'restarts' threshold
+func newResourceRestartTracker(thresholds map[string]containerThreshold) *restartTracker {
+	window := 0
+	for _, threshold := range thresholds {
+		if threshold.Restarts != 0 && threshold.restartWindow() > window {
+			window = threshold.restartWindow()
+		}
+	}
+	return newRestartTracker(restartConfig{Window: window})
+}
+
+// watchContainerResources checks the resource usage of the containers against their configured thresholds.
+// It also returns the keys of the resources which could not be measured, e.g. on a docker API error.
+func watchContainerResources(cli *client.Client, thresholds map[string]containerThreshold, restarts *restartTracker) ([]sysFinding, map[string]bool) {
+	findings := []sysFinding{}
+	unknown := map[string]bool{}
+	now := time.Now()
+
+	containers := []string{}
+	for containerName := range thresholds {
+		containers = append(containers, containerName)
+	}
+	sort.Strings(containers)
+
+	inspected, err := inspectContainers(cli, containers)
+	if err != nil {
+		logError("Cannot inspect the containers. Because:", err.Error())
+		for _, containerName := range containers {
+			for _, resource := range []string{"restarts", "oom", "cpu", "memory"} {
+				unknown[resource+":"+containerName] = true
+			}
+		}
+		return findings, unknown
+	}
+
+	for containerName, details := range inspected {
+		if thresholds[containerName].Restarts != 0 {
+			restarts.observe(containerName, details, now)
+		}
+	}
+	restarts.forget(inspected)
+
+	for _, containerName := range containers {
+		threshold := thresholds[containerName]
+		details, ok := inspected[containerName]
+		if !ok || details.ContainerJSONBase == nil || details.State == nil {
+			// Missing containers are reported by the container checks
+			continue
+		}
+
+		// The restarts are counted since admon started watching the container, as the RestartCount of docker only goes up.
+		// Like the 'maxRestarts' of the restart check, the threshold is the number of restarts allowed.
+		if recent := restarts.recentRestarts(containerName, time.Duration(threshold.restartWindow())*time.Second, now); threshold.Restarts != 0 && recent > threshold.Restarts {
+			findings = append(findings, sysFinding{
+				key:       "restarts:" + containerName,
+				resource:  fmt.Sprintf("Restarts of the container '%s'", containerName),
+				value:     float64(recent),
+				threshold: float64(threshold.Restarts),
+				message:   fmt.Sprintf("The container '%s' restarted '%d' times in the last %s. Current threshold value: '%d'\n", containerName, recent, time.Duration(threshold.restartWindow())*time.Second, threshold.Restarts),
+			})
+		}
+
+		if threshold.OOMKilled && details.State.OOMKilled {
+			findings = append(findings, sysFinding{
+				key:      "oom:" + containerName,
+				resource: fmt.Sprintf("OOM kill of the container '%s'", containerName),
+				value:    1,
+				message:  fmt.Sprintf("The container '%s' was killed by the OOM killer. Exit code: '%d'\n", containerName, details.State.ExitCode),
+				flag:     true,
+			})
+		}
+
+		if (threshold.CPU == 0 && threshold.Memory == 0) || !details.State.Running {
+			continue
+		}
+
+		stats, err := fetchContainerStats(cli, details.ID)
+		if err != nil {
+			logErrorf("Cannot fetch the stats of the container '%s'. Because: %s", containerName, err.Error())
+			unknown["cpu:"+containerName], unknown["memory:"+containerName] = true, true
+			continue
+		}
+
+		if threshold.CPU != 0 && stats.cpuUsagePercentage >= threshold.CPU {
+			findings = append(findings, sysFinding{
+				key:       "cpu:" + containerName,
+				resource:  fmt.Sprintf("CPU utilisation of the container '%s'", containerName),
+				unit:      "%",
+				value:     stats.cpuUsagePercentage,
+				threshold: threshold.CPU,
+				message:   fmt.Sprintf("CPU utilisation of the container '%s' reached '%.2f%%'. Current threshold value: '%.2f%%'\n", containerName, stats.cpuUsagePercentage, threshold.CPU),
+			})
+		}
+
+		if threshold.Memory != 0 && stats.memUsagePercentage >= threshold.Memory {
+			findings = append(findings, sysFinding{
+				key:       "memory:" + containerName,
+				resource:  fmt.Sprintf("Memory utilisation of the container '%s'", containerName),
+				unit:      "%",
+				value:     stats.memUsagePercentage,
+				threshold: threshold.Memory,
+				message:   fmt.Sprintf("Memory utilisation of the container '%s' reached '%.2f%%' (%d of %d bytes). Current threshold value: '%.2f%%'\n", containerName, stats.memUsagePercentage, stats.memUsage, stats.memLimit, threshold.Memory),
+			})
+		}
+	}
+
+	return findings, unknown
+}
+
+// fetchContainerStats takes a single sample of the docker stats API.
+// The CPU & memory calculations are the same as the 'docker stats' command.
+func fetchContainerStats(cli *client.Client, containerID string) (containerStats, error) {
+	result := containerStats{}
+
+	response, err := cli.ContainerStats(context.Background(), containerID, false)
+	if err != nil {
+		return result, err
+	}
+	defer response.Body.Close()
+
+	stats := types.StatsJSON{}
+	if err := json.NewDecoder(response.Body).Decode(&stats); err != nil {
+		logError("Cannot decode the container stats")
+		return result, err
+	}
+
+	// CPU usage since the previous sample, relative to the whole host
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+	onlineCPUs := float64(stats.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		result.cpuUsagePercentage = (cpuDelta / systemDelta) * onlineCPUs * 100
+	}
+
+	// Page cache is not counted as used memory
+	result.memUsage = stats.MemoryStats.Usage
+	if inactive, ok := stats.MemoryStats.Stats["total_inactive_file"]; ok && inactive < result.memUsage {
+		// cgroup v1
+		result.memUsage -= inactive
+	} else if inactive := stats.MemoryStats.Stats["inactive_file"]; inactive < result.memUsage {
+		// cgroup v2
+		result.memUsage -= inactive
+	}
+	result.memLimit = stats.MemoryStats.Limit
+	if result.memLimit > 0 {
+		result.memUsagePercentage = float64(result.memUsage) / float64(result.memLimit) * 100
+	}
+
+	return result, nil
+}
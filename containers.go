@@ -0,0 +1,127 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+// dockerDaemonItem is the item tracked by the daemon unavailable alerts
+const dockerDaemonItem = "Docker daemon"
+
+// containerChecker runs all the container checks against a single long lived docker client
+type containerChecker struct {
+	cli        *client.Client
+	notifiers  *dispatcher
+	store      *stateStore
+	configData adMonConfig
+	restarts   *restartTracker
+	resources  *thresholdAlerter
+	// resourceRestarts counts the restarts of the containers for the 'restarts' thresholds
+	resourceRestarts *restartTracker
+}
+
+func newContainerChecker(cli *client.Client, notifiers *dispatcher, store *stateStore, configData adMonConfig) *containerChecker {
+	return &containerChecker{
+		cli:              cli,
+		notifiers:        notifiers,
+		store:            store,
+		configData:       configData,
+		restarts:         newRestartTracker(configData.RestartCheck),
+		resources:        newThresholdAlerter(containerResourceAlert, newEscalationPolicy(configData, containerResourceAlert, configData.SnoozeTime), store),
+		resourceRestarts: newResourceRestartTracker(configData.ContainerThresholds),
+	}
+}
+
+// check looks for the missing, unhealthy and restarting containers and the containers over their resource thresholds, and sends the alerts
+func (c *containerChecker) check() {
+	containerNetwork := c.configData.Network
+
+	//
+	logInfof("Looking for containers in %q network ...", containerNetwork)
+
+	running, err := listRunningContainers(c.cli, containerNetwork)
+	if err != nil {
+		// The state of the containers is unknown, so the container alerts are left as they are until the daemon is back
+		logError("Cannot get running containers. Because:", err.Error())
+		checkTrackedAlert(c.notifiers, c.store, c.configData, daemonAlert, map[string]string{
+			dockerDaemonItem: fmt.Sprintf("%s - %s", dockerDaemonItem, err.Error()),
+		})
+		return
+	}
+	isFine := checkTrackedAlert(c.notifiers, c.store, c.configData, daemonAlert, map[string]string{})
+
+	selection := selectContainers(c.configData.Containers, c.configData.ContainerSelectors, running)
+	if len(selection.missing) > 0 {
+		//
+		logInfo("Missing Containers:", sortedNames(selection.missing))
+	}
+	isFine = checkTrackedAlert(c.notifiers, c.store, c.configData, containerAlert, selection.missing) && isFine
+	containersToCheck := selection.monitored
+
+	//
+	if c.configData.HealthCheck.Enabled {
+		unhealthyContainers, err := getUnhealthyContainers(c.cli, containerNetwork, containersToCheck, c.configData.HealthCheck.StartingGracePeriod)
+		if err != nil {
+			logError("Cannot check the health of the containers. Because:", err.Error())
+		} else {
+			if len(unhealthyContainers) > 0 {
+				logInfo("Unhealthy Containers:", sortedNames(unhealthyContainers))
+			}
+			isFine = checkTrackedAlert(c.notifiers, c.store, c.configData, healthAlert, unhealthyContainers) && isFine
+		}
+	}
+
+	//
+	if c.configData.RestartCheck.Enabled {
+		// The containers seen restarting before are inspected too, even when they are not running anymore
+		containers := append([]string{}, containersToCheck...)
+		for _, containerName := range c.restarts.tracked() {
+			if !containsString(containers, containerName) {
+				containers = append(containers, containerName)
+			}
+		}
+
+		inspected, err := inspectContainers(c.cli, containers)
+		if err != nil {
+			logError("Cannot check the restarts of the containers. Because:", err.Error())
+		} else {
+			now := time.Now()
+			for containerName, details := range inspected {
+				c.restarts.observe(containerName, details, now)
+			}
+			c.restarts.forget(inspected)
+			flappingContainers := c.restarts.flapping(now)
+			if len(flappingContainers) > 0 {
+				logInfo("Restarting Containers:", sortedNames(flappingContainers))
+			}
+			isFine = checkTrackedAlert(c.notifiers, c.store, c.configData, restartAlert, flappingContainers) && isFine
+		}
+	}
+
+	//
+	if len(c.configData.ContainerThresholds) > 0 {
+		findings, unknown := watchContainerResources(c.cli, c.configData.ContainerThresholds, c.resourceRestarts)
+		c.resources.process(c.notifiers, c.configData, findings, unknown)
+		isFine = len(findings) == 0 && isFine
+	}
+
+	if isFine {
+		logInfo("Everything Looks Good!")
+	}
+}
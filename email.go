@@ -0,0 +1,173 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/gomail.v2"
+)
+
+type emailNotifier struct {
+	smtp      smtpConfig
+	sender    *smtpSender
+	templates *mailTemplates
+}
+
+func newEmailNotifier(config adMonConfig) (notifier, error) {
+	sender, err := newSMTPSender(config.SMTP)
+	if err != nil {
+		return nil, err
+	}
+	templates, err := loadMailTemplates(filepath.Join(configDir, templatesDirName))
+	if err != nil {
+		return nil, err
+	}
+	return &emailNotifier{smtp: config.SMTP, sender: sender, templates: templates}, nil
+}
+
+func (e *emailNotifier) name() string {
+	return "email"
+}
+
+func (e *emailNotifier) notify(n notification) error {
+	var subject string
+	switch n.Type {
+	case containerAlert, errorAlert:
+		subject = e.smtp.EmailSubject
+	case systemAlert:
+		subject = e.smtp.SysAlertSubject
+	default:
+		subject = "[ALERT] " + n.title() + " | Admon"
+	}
+	if n.State == alertResolved {
+		subject = e.smtp.ResolvedSubject
+		if subject == "" {
+			subject = "[RESOLVED] " + n.title() + " | Admon"
+		}
+	}
+
+	//
+	// Create a new message.
+	m := gomail.NewMessage()
+
+	//
+	htmlTemplate, textTemplate := e.templates.html[n.Type], e.templates.text[n.Type]
+	if htmlTemplate == nil || textTemplate == nil {
+		return fmt.Errorf("no email template for the %s alerts", n.Type)
+	}
+	data := newMailData(n)
+
+	//
+	var mailBody bytes.Buffer
+	if err := htmlTemplate.Execute(&mailBody, data); err != nil {
+		logErrorf("Cannot execute %s email template", n.Type)
+		return err
+	}
+
+	//
+	var textBody bytes.Buffer
+	if err := textTemplate.Execute(&textBody, data); err != nil {
+		logErrorf("Cannot execute %s text email template", n.Type)
+		return err
+	}
+
+	// multipart/alternative, the clients show the last part they support, so the html goes last
+	m.SetBody("text/plain", textBody.String())
+	m.AddAlternative("text/html", mailBody.String())
+
+	// Construct the message headers, including a Configuration Set and a Tag.
+	m.SetHeaders(map[string][]string{
+		"From":    {m.FormatAddress(e.smtp.SenderAddr, e.smtp.SenderName)},
+		"Subject": {subject},
+	})
+
+	receivers := e.smtp.ReceiverAddrs
+	if len(n.Receivers) > 0 {
+		receivers = n.Receivers
+	}
+	m.SetHeader("To", receivers...)
+
+	// The headers for the mail rules
+	m.SetHeader("X-Admon-Host", n.Host)
+	m.SetHeader("X-Admon-Alert-Type", string(n.Type))
+	m.SetHeader("X-Admon-Alert-State", string(n.State))
+	m.SetHeader("X-Admon-Alert-ID", data.AlertID)
+
+	// Threads the mail with the other ones about the same items
+	messageID, references := threadIDs(n)
+	m.SetHeader("Message-ID", messageID)
+	m.SetHeader("In-Reply-To", references[0])
+	m.SetHeader("References", strings.Join(references, " "))
+
+	// Send the email, reusing the open connection if any
+	if err := gomail.Send(e.sender, m); err != nil {
+		logErrorf("Failed while dialing for %s alert mail ..", n.Type)
+		return err
+	}
+	return nil
+}
+
+// threadIDs returns a new Message-ID for the mail and the Message-IDs of the threads of its items.
+// A thread is identified by its item and when the item started failing, so every mail about the item,
+// from the first alert to the resolved one, refers to the same thread, even across restarts.
+func threadIDs(n notification) (string, []string) {
+	host := n.Host
+	if host == "" {
+		host = "admon"
+	}
+	ids := itemIDs(n)
+	messageID := fmt.Sprintf("<%s.%d@%s>", hashID(ids...), n.Time.UnixNano(), host)
+
+	references := []string{}
+	for _, id := range ids {
+		references = append(references, fmt.Sprintf("<%s@%s>", id, host))
+	}
+	return messageID, references
+}
+
+// alertID identifies the items of the notification, see itemIDs
+func alertID(n notification) string {
+	return strings.Join(itemIDs(n), " ")
+}
+
+// itemIDs identify every item of the notification from when it started failing until it is resolved,
+// whatever the items notified along with it. The admon errors are identified by their message.
+func itemIDs(n notification) []string {
+	if len(n.Keys) == 0 {
+		return []string{hashID(n.Host, string(n.Type), n.ErrorMessage)}
+	}
+
+	ids := []string{}
+	for i, key := range n.Keys {
+		firstSeen := int64(0)
+		if i < len(n.FirstSeen) {
+			firstSeen = n.FirstSeen[i].Unix()
+		}
+		ids = append(ids, hashID(n.Host, string(n.Type), key, strconv.FormatInt(firstSeen, 10)))
+	}
+	return ids
+}
+
+func hashID(parts ...string) string {
+	hash := sha1.Sum([]byte(strings.Join(parts, "/")))
+	return hex.EncodeToString(hash[:8])
+}
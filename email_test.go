@@ -0,0 +1,60 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThreadIDs(t *testing.T) {
+	down, up := time.Unix(1000, 0), time.Unix(5000, 0)
+	first := notification{Type: containerAlert, Host: "node1", Keys: []string{"api", "web"}, FirstSeen: []time.Time{down, down}, Time: time.Unix(1000, 0)}
+	_, threads := threadIDs(first)
+	api, web := threads[0], threads[1]
+
+	tests := []struct {
+		name string
+		n    notification
+		want []string
+	}{
+		{"reminder about one of the items", notification{Type: containerAlert, Host: "node1", Keys: []string{"web"}, FirstSeen: []time.Time{down}}, []string{web}},
+		{"resolved along with a new item", notification{Type: containerAlert, State: alertResolved, Host: "node1", Keys: []string{"db", "api"}, FirstSeen: []time.Time{up, down}}, []string{"", api}},
+		{"failing again later", notification{Type: containerAlert, Host: "node1", Keys: []string{"web"}, FirstSeen: []time.Time{up}}, []string{""}},
+		{"other host", notification{Type: containerAlert, Host: "node2", Keys: []string{"web"}, FirstSeen: []time.Time{down}}, []string{""}},
+		{"other alert type", notification{Type: healthAlert, Host: "node1", Keys: []string{"web"}, FirstSeen: []time.Time{down}}, []string{""}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			messageID, got := threadIDs(test.n)
+			if len(got) != len(test.want) {
+				t.Fatalf("threadIDs() = %v, want %d threads", got, len(test.want))
+			}
+			for i, want := range test.want {
+				// An empty thread is a new one, about another incident
+				if want != "" && got[i] != want {
+					t.Errorf("thread of '%s' = %s, want %s", test.n.Keys[i], got[i], want)
+				}
+				if want == "" && (got[i] == api || got[i] == web) {
+					t.Errorf("thread of '%s' = %s, want a new thread", test.n.Keys[i], got[i])
+				}
+				if got[i] == messageID {
+					t.Errorf("the Message-ID %s is the thread of '%s'", messageID, test.n.Keys[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// escalationPolicy decides when a still failing item is notified again, and when its notifications
+// are escalated to more channels / receivers
+type escalationPolicy struct {
+	// repeat are the waits in seconds after each notification, the last one being used for all the next notifications
+	repeat        []int
+	escalateAfter int
+	channels      []string
+	receivers     []string
+}
+
+// newEscalationPolicy returns the escalation policy of the alert type, or a fixed repeat of the snooze time without one
+func newEscalationPolicy(config adMonConfig, alert alertType, snoozeTime int) escalationPolicy {
+	policy := escalationPolicy{repeat: []int{snoozeTime}}
+
+	escalation, ok := config.Escalations[string(alert)]
+	if !ok {
+		return policy
+	}
+	if len(escalation.Repeat) > 0 {
+		policy.repeat = escalation.Repeat
+	}
+	policy.escalateAfter = escalation.EscalateAfter
+	policy.channels, policy.receivers = escalation.Channels, escalation.Receivers
+	if len(policy.channels) == 0 && len(policy.receivers) > 0 {
+		// The receivers are email addresses
+		policy.channels = []string{"email"}
+	}
+	return policy
+}
+
+// nextNotification is the time the item is notified again, if it is still failing by then
+func (p escalationPolicy) nextNotification(state itemState) int64 {
+	i := state.NotificationCount - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(p.repeat) {
+		i = len(p.repeat) - 1
+	}
+	return time.Unix(state.LastNotified, 0).Add(time.Duration(p.repeat[i]) * time.Second).Unix()
+}
+
+// escalates tells whether the notification number 'count' of an item goes to the escalation channels,
+// i.e. whether the item was already notified 'escalateAfter' times before
+func (p escalationPolicy) escalates(count int) bool {
+	return p.escalateAfter > 0 && count > p.escalateAfter
+}
+
+// validateEscalations checks the alert types, the repeat intervals and the channels of the escalation policies
+func validateEscalations(escalations map[string]escalationConfig) error {
+	for alert, escalation := range escalations {
+		if alert == string(errorAlert) {
+			return errors.New("the admon errors cannot be escalated, they are repeated every 'SnoozeTime' seconds")
+		}
+		if !containsString(alertTypeNames(), alert) {
+			return fmt.Errorf("unknown alert type '%s' in the escalations. Supported types: %s", alert, strings.Join(alertTypeNames(), ", "))
+		}
+		for _, repeat := range escalation.Repeat {
+			if repeat <= 0 {
+				return fmt.Errorf("the repeat intervals of the '%s' escalation must be positive, got %d", alert, repeat)
+			}
+		}
+		if escalation.EscalateAfter < 0 {
+			return fmt.Errorf("the 'escalateAfter' of the '%s' escalation cannot be negative", alert)
+		}
+		if escalation.EscalateAfter > 0 && len(escalation.Channels) == 0 && len(escalation.Receivers) == 0 {
+			return fmt.Errorf("the '%s' escalation sets 'escalateAfter', but no 'channels' or 'receivers' to escalate to", alert)
+		}
+		for _, channel := range escalation.Channels {
+			if _, ok := notifierRegistry[channel]; !ok {
+				return fmt.Errorf("unknown notification channel '%s' in the '%s' escalation. Supported channels: %s", channel, alert, strings.Join(registeredChannels(), ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// escalationChannels lists the channels of all the escalation policies
+func escalationChannels(config adMonConfig) []string {
+	channels := []string{}
+	for alert := range config.Escalations {
+		for _, channel := range newEscalationPolicy(config, alertType(alert), 0).channels {
+			if !containsString(channels, channel) {
+				channels = append(channels, channel)
+			}
+		}
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// escalate sends the notification to the escalation channels & receivers of the policy, on top of its routes
+func (d *dispatcher) escalate(n notification, policy escalationPolicy) error {
+	failures := []string{}
+	n = d.complete(n)
+	n.Receivers = policy.receivers
+	d.history.record(historyEscalated, n, strings.Join(policy.channels, ","), nil)
+
+	for _, channel := range d.notifiers {
+		if !containsString(policy.channels, channel.name()) {
+			continue
+		}
+		if err := d.send(channel, n); err != nil {
+			failures = append(failures, channel.name()+": "+err.Error())
+		}
+	}
+
+	if len(failures) > 0 {
+		return errors.New("failed to escalate via " + strings.Join(failures, "; "))
+	}
+	return nil
+}
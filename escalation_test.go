@@ -0,0 +1,92 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNextNotification(t *testing.T) {
+	schedule := escalationPolicy{repeat: []int{600, 1800, 3600}}
+
+	tests := []struct {
+		name   string
+		policy escalationPolicy
+		state  itemState
+		want   int64
+	}{
+		{"fixed snooze time", escalationPolicy{repeat: []int{360}}, itemState{LastNotified: 1000, NotificationCount: 4}, 1360},
+		{"never counted", schedule, itemState{LastNotified: 1000}, 1600},
+		{"after the first notification", schedule, itemState{LastNotified: 1000, NotificationCount: 1}, 1600},
+		{"after the second notification", schedule, itemState{LastNotified: 1000, NotificationCount: 2}, 2800},
+		{"after the third notification", schedule, itemState{LastNotified: 1000, NotificationCount: 3}, 4600},
+		{"last repeat goes on", schedule, itemState{LastNotified: 1000, NotificationCount: 10}, 4600},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.policy.nextNotification(test.state); got != test.want {
+				t.Errorf("nextNotification(%+v) = %d, want %d", test.state, got, test.want)
+			}
+		})
+	}
+}
+
+func TestEscalates(t *testing.T) {
+	tests := []struct {
+		escalateAfter int
+		count         int
+		want          bool
+	}{
+		{0, 1, false},
+		{0, 100, false},
+		{3, 1, false},
+		{3, 3, false},
+		{3, 4, true},
+		{3, 10, true},
+	}
+
+	for _, test := range tests {
+		policy := escalationPolicy{repeat: []int{600}, escalateAfter: test.escalateAfter}
+		if got := policy.escalates(test.count); got != test.want {
+			t.Errorf("escalates(%d) with escalateAfter %d = %t, want %t", test.count, test.escalateAfter, got, test.want)
+		}
+	}
+}
+
+func TestCompareStates(t *testing.T) {
+	policy := escalationPolicy{repeat: []int{600, 1800}}
+	lastState := map[string]itemState{
+		// due: notified once, 600 seconds ago
+		"web": {FirstSeen: 1000, LastNotified: 1400, NotificationCount: 1},
+		// snoozed: notified twice, the second repeat is 1800 seconds
+		"api": {FirstSeen: 1000, LastNotified: 1400, NotificationCount: 2},
+	}
+
+	newState, due := compareStates(policy, lastState, map[string]int64{"web": 2000, "api": 2000, "db": 2000})
+
+	if want := []string{"db", "web"}; !reflect.DeepEqual(due, want) {
+		t.Errorf("compareStates() due = %v, want %v", due, want)
+	}
+	want := map[string]itemState{
+		"web": {FirstSeen: 1000, LastNotified: 2000, NotificationCount: 1},
+		"api": {FirstSeen: 1000, LastNotified: 1400, NotificationCount: 2},
+		"db":  {FirstSeen: 2000, LastNotified: 2000},
+	}
+	if !reflect.DeepEqual(newState, want) {
+		t.Errorf("compareStates() state = %+v, want %+v", newState, want)
+	}
+}
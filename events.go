@@ -0,0 +1,120 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+const (
+	eventsBufferSize = 100
+	// eventsDebounce is how long the related events (e.g. kill, die & stop of the same container) are batched into a single check
+	eventsDebounce = 2 * time.Second
+	// Wait times before re-subscribing to a broken events stream
+	eventsMinBackoff = 1 * time.Second
+	eventsMaxBackoff = 60 * time.Second
+)
+
+// watchedEvents are the container events which may change the result of the checks
+var watchedEvents = []string{"die", "oom", "kill", "health_status", "stop"}
+
+// watchDockerEvents subscribes to the docker events stream and forwards the events of the monitored containers.
+// It re-subscribes, with an exponential backoff, whenever the stream breaks and never returns.
+func watchDockerEvents(cli *client.Client, configData adMonConfig, out chan<- events.Message) {
+	logInfo("Initialised Docker Events Watcher ..")
+
+	backoff := eventsMinBackoff
+	since := time.Now()
+	for {
+		eventFilters := filters.NewArgs()
+		eventFilters.Add("type", events.ContainerEventType)
+		for _, event := range watchedEvents {
+			eventFilters.Add("event", event)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		// Replays the events missed while the stream was broken
+		messages, errs := cli.Events(ctx, types.EventsOptions{
+			Since:   strconv.FormatInt(since.Unix(), 10),
+			Filters: eventFilters,
+		})
+
+	stream:
+		for {
+			select {
+			case message := <-messages:
+				backoff = eventsMinBackoff
+				since = time.Unix(0, message.TimeNano)
+				// The event attributes include the container labels
+				if isMonitored(configData, message.Actor.Attributes["name"], message.Actor.Attributes) {
+					out <- message
+				}
+			case err := <-errs:
+				logErrorf("The docker events stream is broken. Re-subscribing in %s. Because: %s", backoff, err.Error())
+				break stream
+			}
+		}
+		cancel()
+
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > eventsMaxBackoff {
+			backoff = eventsMaxBackoff
+		}
+	}
+}
+
+// collectEvents batches the events arriving shortly after the first one
+func collectEvents(first events.Message, in <-chan events.Message) []events.Message {
+	batch := []events.Message{first}
+	timer := time.NewTimer(eventsDebounce)
+	defer timer.Stop()
+
+	for {
+		select {
+		case message := <-in:
+			batch = append(batch, message)
+		case <-timer.C:
+			return batch
+		}
+	}
+}
+
+// handleEvents feeds the exit details of the events to the restart tracker, ahead of the next check
+func (c *containerChecker) handleEvents(batch []events.Message) {
+	for _, message := range batch {
+		containerName := message.Actor.Attributes["name"]
+		logInfof("Received the docker event '%s' for the container '%s'", message.Action, containerName)
+
+		switch message.Action {
+		case "die":
+			exitCode, err := strconv.Atoi(message.Actor.Attributes["exitCode"])
+			if err != nil {
+				logErrorf("Cannot parse the exit code of the container '%s'. Because: %s", containerName, err.Error())
+				continue
+			}
+			c.restarts.recordExit(containerName, exitCode)
+		case "oom":
+			c.restarts.recordOOM(containerName)
+		}
+	}
+}
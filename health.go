@@ -0,0 +1,114 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// maxProbeOutputLength limits the health probe output included in the alerts
+const maxProbeOutputLength = 500
+
+// getUnhealthyContainers returns the monitored containers that are running but failing their HEALTHCHECK,
+// or stuck in the 'starting' health state beyond the grace period, mapped to their alert messages
+func getUnhealthyContainers(cli *client.Client, containerNetwork string, containersToCheck []string, startingGracePeriod int) (map[string]string, error) {
+	unhealthy := map[string]string{}
+	ctx := context.Background()
+
+	//
+	clFilters := filters.NewArgs()
+	if containerNetwork != "all" {
+		clFilters.Add("network", containerNetwork)
+	}
+	clFilters.Add("status", "running")
+	clFilters.Add("health", types.Unhealthy)
+	clFilters.Add("health", types.Starting)
+	containerOpts := types.ContainerListOptions{
+		Filters: clFilters,
+	}
+
+	localContainers, err := cli.ContainerList(ctx, containerOpts)
+	if err != nil {
+		logError("Failed to get local containers list from API")
+		return unhealthy, err
+	}
+
+	for _, container := range localContainers {
+		containerName := strings.TrimPrefix(container.Names[0], "/")
+		if !containsString(containersToCheck, containerName) {
+			continue
+		}
+
+		details, err := cli.ContainerInspect(ctx, container.ID)
+		if err != nil {
+			logErrorf("Cannot inspect the container '%s'. Because: %s", containerName, err.Error())
+			continue
+		}
+		if details.State == nil || details.State.Health == nil {
+			continue
+		}
+
+		if message, ok := healthMessage(containerName, details.State, startingGracePeriod); ok {
+			unhealthy[containerName] = message
+		}
+	}
+
+	return unhealthy, nil
+}
+
+// healthMessage describes the health state of a container. It returns false when the state doesn't need an alert.
+func healthMessage(containerName string, state *types.ContainerState, startingGracePeriod int) (string, bool) {
+	health := state.Health
+
+	switch health.Status {
+	case types.Unhealthy:
+		return fmt.Sprintf("%s - unhealthy after %d failed probes. Last probe output: %s", containerName, health.FailingStreak, lastProbeOutput(health)), true
+	case types.Starting:
+		startedAt, err := time.Parse(time.RFC3339Nano, state.StartedAt)
+		if err != nil {
+			logErrorf("Cannot parse the start time of the container '%s'. Because: %s", containerName, err.Error())
+			return "", false
+		}
+
+		startingFor := time.Since(startedAt).Round(time.Second)
+		if startingFor > time.Duration(startingGracePeriod)*time.Second {
+			return fmt.Sprintf("%s - health check is still starting after %s. Last probe output: %s", containerName, startingFor, lastProbeOutput(health)), true
+		}
+	}
+	return "", false
+}
+
+func lastProbeOutput(health *types.Health) string {
+	if len(health.Log) == 0 {
+		return "(no probe results yet)"
+	}
+
+	lastProbe := health.Log[len(health.Log)-1]
+	output := strings.Join(strings.Fields(lastProbe.Output), " ")
+	if truncated := truncateText(output, maxProbeOutputLength); truncated != output {
+		output = truncated + " ..."
+	}
+	if output == "" {
+		output = "(empty)"
+	}
+	return fmt.Sprintf("'%s' (exit code %d)", output, lastProbe.ExitCode)
+}
@@ -0,0 +1,44 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestLastProbeOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		log  []*types.HealthcheckResult
+		want string
+	}{
+		{"no probe yet", nil, "(no probe results yet)"},
+		{"empty output", []*types.HealthcheckResult{{ExitCode: 1}}, "'(empty)' (exit code 1)"},
+		{"last probe only", []*types.HealthcheckResult{{Output: "ok"}, {Output: "connection\n  refused\n", ExitCode: 7}}, "'connection refused' (exit code 7)"},
+		{"long output", []*types.HealthcheckResult{{Output: strings.Repeat("x", 600), ExitCode: 1}}, "'" + strings.Repeat("x", 500) + " ...' (exit code 1)"},
+		{"long multi-byte output", []*types.HealthcheckResult{{Output: strings.Repeat("é", 600), ExitCode: 1}}, "'" + strings.Repeat("é", 500) + " ...' (exit code 1)"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := lastProbeOutput(&types.Health{Log: test.log}); got != test.want {
+				t.Errorf("lastProbeOutput() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,389 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	historyDirName      = "history"
+	historyFileName     = "events.jsonl"
+	defaultHistorySize  = 10
+	defaultHistoryFiles = 5
+)
+
+type historyEventKind string
+
+const (
+	// historyFired is a newly failing item
+	historyFired historyEventKind = "fired"
+	// historyRenotified is a still failing item notified again once its snooze time was over
+	historyRenotified historyEventKind = "renotified"
+	// historySnoozed is a still failing item not notified because of its snooze time,
+	// recorded once when the item is snoozed after being due, not on every check
+	historySnoozed  historyEventKind = "snoozed"
+	historyResolved historyEventKind = "resolved"
+	// historySilenced is a failing or resolved item not notified because of a silence or a maintenance window
+	historySilenced historyEventKind = "silenced"
+	// historyEscalated is a still failing item notified through the escalation channels of its alert type
+	historyEscalated historyEventKind = "escalated"
+	// historyDeliveryFailed is a notification which could not be sent through a channel
+	historyDeliveryFailed historyEventKind = "deliveryFailed"
+	// historyQueued is a notification queued in the outbox behind the undelivered ones of its channel, without trying to send it
+	historyQueued historyEventKind = "queued"
+	// historyDelivered is a notification of the outbox finally sent through a channel
+	historyDelivered historyEventKind = "delivered"
+)
+
+// historyEvent is a line of the alert history, about a single item
+type historyEvent struct {
+	Time    time.Time        `json:"time"`
+	Event   historyEventKind `json:"event"`
+	Type    alertType        `json:"type"`
+	State   alertState       `json:"state"`
+	Host    string           `json:"host"`
+	Item    string           `json:"item,omitempty"`
+	Message string           `json:"message,omitempty"`
+	Channel string           `json:"channel,omitempty"`
+	Error   string           `json:"error,omitempty"`
+	// Silence is the silence or the maintenance window muting the item
+	Silence string `json:"silence,omitempty"`
+}
+
+// alertHistory appends the alert events to a JSON lines file, rotated once it reaches the max size.
+// The methods do nothing on a nil history, i.e. when the history is disabled.
+type alertHistory struct {
+	dir      string
+	host     string
+	maxSize  int64
+	maxFiles int
+
+	mu sync.Mutex
+	// snoozed are the items whose snoozed event is recorded, until they get another event
+	snoozed map[string]bool
+}
+
+func newAlertHistory(dir string, host string, config historyConfig) (*alertHistory, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	maxSize, maxFiles := config.MaxSize, config.MaxFiles
+	if maxSize <= 0 {
+		maxSize = defaultHistorySize
+	}
+	if maxFiles <= 0 {
+		maxFiles = defaultHistoryFiles
+	}
+
+	return &alertHistory{
+		dir:      dir,
+		host:     host,
+		maxSize:  int64(maxSize) * 1024 * 1024,
+		maxFiles: maxFiles,
+		snoozed:  map[string]bool{},
+	}, nil
+}
+
+// record adds an event for every item of the notification. The channel and the error are set for the delivery events.
+func (h *alertHistory) record(event historyEventKind, n notification, channel string, err error) {
+	h.recordItems(n, channel, err, func(e *historyEvent) { e.Event = event })
+}
+
+// recordFiring adds a fired event for the new items of the notification and a renotified event for the others
+func (h *alertHistory) recordFiring(n notification, isNew map[string]bool) {
+	h.recordItems(n, "", nil, func(e *historyEvent) {
+		e.Event = historyRenotified
+		if isNew[e.Item] {
+			e.Event = historyFired
+		}
+	})
+}
+
+// recordSilenced adds a silenced event for every item of the notification, along with the silence muting it
+func (h *alertHistory) recordSilenced(n notification, silenced map[string]string) {
+	h.recordItems(n, "", nil, func(e *historyEvent) {
+		e.Event = historySilenced
+		e.Silence = silenced[e.Item]
+	})
+}
+
+// recordItems adds an event for every item of the notification, completed by 'describe'
+func (h *alertHistory) recordItems(n notification, channel string, err error, describe func(e *historyEvent)) {
+	if h == nil {
+		return
+	}
+
+	base := historyEvent{Time: time.Now(), Type: n.Type, State: n.State, Host: n.Host, Channel: channel}
+	if base.State == "" {
+		base.State = alertFiring
+	}
+	if base.Host == "" {
+		base.Host = h.host
+	}
+	if err != nil {
+		base.Error = err.Error()
+	}
+
+	events := []historyEvent{}
+	if len(n.Keys) == 0 {
+		// The notifications without items, e.g. the admon errors
+		event := base
+		event.Message = n.ErrorMessage
+		if len(n.Items) > 0 {
+			event.Message = strings.TrimSpace(strings.Join(n.Items, " "))
+		}
+		describe(&event)
+		events = append(events, event)
+	}
+	for i, key := range n.Keys {
+		event := base
+		event.Item = key
+		if i < len(n.Items) {
+			event.Message = strings.TrimSpace(n.Items[i])
+		}
+		describe(&event)
+		events = append(events, event)
+	}
+
+	if err := h.write(h.skipSnoozed(events, channel)); err != nil {
+		logError("Cannot write to the alert history. Because:", err.Error())
+	}
+}
+
+// skipSnoozed drops the snoozed events of the items already recorded as snoozed, so a snoozed item
+// is recorded once rather than on every check. The delivery events, set with a channel, are kept as they are.
+func (h *alertHistory) skipSnoozed(events []historyEvent, channel string) []historyEvent {
+	if channel != "" {
+		return events
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	kept := []historyEvent{}
+	for _, event := range events {
+		item := string(event.Type) + "/" + event.Item
+		if event.Item == "" {
+			item += event.Message
+		}
+		switch {
+		case event.Event != historySnoozed:
+			delete(h.snoozed, item)
+		case h.snoozed[item]:
+			continue
+		default:
+			h.snoozed[item] = true
+		}
+		kept = append(kept, event)
+	}
+	return kept
+}
+
+func (h *alertHistory) write(events []historyEvent) error {
+	data := []byte{}
+	for _, event := range events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	historyFile := filepath.Join(h.dir, historyFileName)
+	if info, err := os.Stat(historyFile); err == nil && info.Size() > 0 && info.Size()+int64(len(data)) > h.maxSize {
+		if err := h.rotate(); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.OpenFile(historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// rotate renames 'events.jsonl' to 'events.1.jsonl', 'events.1.jsonl' to 'events.2.jsonl' ... dropping the oldest file
+func (h *alertHistory) rotate() error {
+	if err := os.Remove(rotatedHistoryFile(h.dir, h.maxFiles-1)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := h.maxFiles - 2; i >= 0; i-- {
+		if err := os.Rename(rotatedHistoryFile(h.dir, i), rotatedHistoryFile(h.dir, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// rotatedHistoryFile is the path of the history file rotated i times, the current file being 0
+func rotatedHistoryFile(dir string, i int) string {
+	if i == 0 {
+		return filepath.Join(dir, historyFileName)
+	}
+	return filepath.Join(dir, strings.TrimSuffix(historyFileName, ".jsonl")+"."+strconv.Itoa(i)+".jsonl")
+}
+
+// historyFilter selects the events of the 'history' command
+type historyFilter struct {
+	since time.Time
+	until time.Time
+	types []string
+	item  string
+}
+
+func (f historyFilter) matches(event historyEvent) bool {
+	if !f.since.IsZero() && event.Time.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && event.Time.After(f.until) {
+		return false
+	}
+	if len(f.types) > 0 && !containsString(f.types, string(event.Type)) {
+		return false
+	}
+	if f.item != "" && event.Item != f.item && !matchesAnyPattern([]string{f.item}, event.Item) {
+		return false
+	}
+	return true
+}
+
+// readHistory returns the events of all the history files matching the filter, oldest first
+func readHistory(dir string, filter historyFilter) ([]historyEvent, error) {
+	rotated, err := filepath.Glob(filepath.Join(dir, strings.TrimSuffix(historyFileName, ".jsonl")+".*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+
+	events := []historyEvent{}
+	for i := len(rotated); i >= 0; i-- {
+		file, err := os.Open(rotatedHistoryFile(dir, i))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			event := historyEvent{}
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+				// A crash may leave a partial last line behind
+				continue
+			}
+			if filter.matches(event) {
+				events = append(events, event)
+			}
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
+
+// parseHistoryTime accepts a date, a date & time, or a duration before now, e.g. '2h' or '7d'.
+// With endOfDay, a date alone stands for the end of that day, so '--until 2006-01-02' includes the whole day.
+func parseHistoryTime(value string, now time.Time, endOfDay bool) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if duration, err := parseDuration(value); err == nil {
+		return now.Add(-duration), nil
+	}
+	if parsed, err := parseDate(value); err == nil {
+		if endOfDay && len(value) == len("2006-01-02") {
+			return parsed.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+		}
+		return parsed, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%s'. Use a duration like '2h' or '7d', a date like '2006-01-02' or an RFC 3339 time", value)
+}
+
+// printHistory lists the alert events for the 'history' command, as a table or as JSON
+func printHistory(dir string, filter historyFilter, output string) error {
+	if output != "table" && output != "json" {
+		return fmt.Errorf("unsupported output '%s'. Supported outputs: table, json", output)
+	}
+
+	events, err := readHistory(dir, filter)
+	if err != nil {
+		return err
+	}
+
+	if output == "json" {
+		data, err := json.MarshalIndent(events, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	if len(events) == 0 {
+		logInfo("No alert event found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tEVENT\tTYPE\tITEM\tCHANNEL\tDETAILS")
+	for _, event := range events {
+		item, channel, details := event.Item, event.Channel, event.Message
+		if item == "" {
+			item = "-"
+		}
+		if channel == "" {
+			channel = "-"
+		}
+		if event.Error != "" {
+			details = event.Error
+		}
+		if event.Silence != "" {
+			details = "[" + event.Silence + "] " + details
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			event.Time.Local().Format("2006-01-02 15:04:05"),
+			event.Event,
+			event.Type,
+			item,
+			channel,
+			strings.ReplaceAll(details, "\n", " "),
+		)
+	}
+	return w.Flush()
+}
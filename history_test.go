@@ -0,0 +1,83 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseHistoryTime(t *testing.T) {
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		value    string
+		endOfDay bool
+		want     time.Time
+	}{
+		{"", false, time.Time{}},
+		{"2h", false, time.Date(2024, 6, 10, 10, 0, 0, 0, time.Local)},
+		{"7d", true, time.Date(2024, 6, 3, 12, 0, 0, 0, time.Local)},
+		{"2024-06-01", false, time.Date(2024, 6, 1, 0, 0, 0, 0, time.Local)},
+		{"2024-06-01", true, time.Date(2024, 6, 2, 0, 0, 0, 0, time.Local).Add(-time.Nanosecond)},
+		{"2024-06-01 15:04", true, time.Date(2024, 6, 1, 15, 4, 0, 0, time.Local)},
+		{"2024-06-01T15:04:05Z", true, time.Date(2024, 6, 1, 15, 4, 5, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		got, err := parseHistoryTime(test.value, now, test.endOfDay)
+		if err != nil {
+			t.Errorf("parseHistoryTime(%q, %t) returned the error: %s", test.value, test.endOfDay, err)
+		} else if !got.Equal(test.want) {
+			t.Errorf("parseHistoryTime(%q, %t) = %s, want %s", test.value, test.endOfDay, got, test.want)
+		}
+	}
+
+	if _, err := parseHistoryTime("yesterday", now, false); err == nil {
+		t.Error("parseHistoryTime(\"yesterday\") returned no error")
+	}
+}
+
+func TestHistorySnoozedOnce(t *testing.T) {
+	h, err := newAlertHistory(t.TempDir(), "node1", historyConfig{})
+	if err != nil {
+		t.Fatalf("newAlertHistory() returned the error: %s", err)
+	}
+	web := notification{Type: containerAlert, Keys: []string{"web"}, Items: []string{"web"}}
+	both := notification{Type: containerAlert, Keys: []string{"api", "web"}, Items: []string{"api", "web"}}
+
+	// Every check of a still failing item
+	h.recordFiring(web, map[string]bool{"web": true})
+	h.record(historySnoozed, web, "", nil)
+	h.record(historySnoozed, web, "", nil)
+	h.record(historyDeliveryFailed, web, "email", nil)
+	h.record(historySnoozed, both, "", nil)
+	h.recordFiring(web, nil)
+	h.record(historySnoozed, web, "", nil)
+
+	events, err := readHistory(h.dir, historyFilter{})
+	if err != nil {
+		t.Fatalf("readHistory() returned the error: %s", err)
+	}
+	got := []string{}
+	for _, event := range events {
+		got = append(got, string(event.Event)+" "+event.Item)
+	}
+	want := []string{"fired web", "snoozed web", "deliveryFailed web", "snoozed api", "renotified web", "snoozed web"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("recorded events = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,79 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const defaultJournalSocket = "/run/systemd/journal/socket"
+
+// journalWriter sends the records to the systemd journal using its native protocol
+// See: https://systemd.io/JOURNAL_NATIVE_PROTOCOL/
+type journalWriter struct {
+	conn *net.UnixConn
+}
+
+func newJournalWriter(config journaldConfig) (*journalWriter, error) {
+	socket := config.Socket
+	if socket == "" {
+		socket = defaultJournalSocket
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &journalWriter{conn: conn}, nil
+}
+
+// writeLog sends the fields upper cased, e.g. the 'alert_type' field is stored as 'ALERT_TYPE'
+func (j *journalWriter) writeLog(severity int, msgID, message string, fields map[string]string) error {
+	var record bytes.Buffer
+	writeJournalField(&record, "MESSAGE", message)
+	writeJournalField(&record, "PRIORITY", strconv.Itoa(severity))
+	writeJournalField(&record, "SYSLOG_IDENTIFIER", "admon")
+	writeJournalField(&record, "ADMON_RECORD", msgID)
+	for name, value := range fields {
+		writeJournalField(&record, strings.ToUpper(name), value)
+	}
+
+	_, err := j.conn.Write(record.Bytes())
+	return err
+}
+
+func writeJournalField(record *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		record.WriteString(name + "=" + value + "\n")
+		return
+	}
+
+	// The multi-line values are written with their length
+	record.WriteString(name + "\n")
+	binary.Write(record, binary.LittleEndian, uint64(len(value)))
+	record.WriteString(value + "\n")
+}
+
+func newJournaldNotifier(config adMonConfig) (notifier, error) {
+	writer, err := newJournalWriter(config.Journald)
+	if err != nil {
+		return nil, err
+	}
+	return &logNotifier{channel: "journald", sink: writer}, nil
+}
@@ -0,0 +1,195 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+// Syslog severity levels, also used by the systemd journal
+const (
+	severityCritical = 2
+	severityError    = 3
+	severityWarning  = 4
+	severityNotice   = 5
+	severityInfo     = 6
+)
+
+// logQueueSize is the number of log lines waiting for the sinks, the next lines are dropped until there is room again
+const logQueueSize = 1000
+
+// logSink writes a structured log record to a local log system
+type logSink interface {
+	writeLog(severity int, msgID, message string, fields map[string]string) error
+}
+
+// logNotifier delivers the alerts as structured log records, one per item
+type logNotifier struct {
+	channel string
+	sink    logSink
+}
+
+func (l *logNotifier) name() string {
+	return l.channel
+}
+
+func (l *logNotifier) notify(n notification) error {
+	severity := severityWarning
+	switch {
+	case n.State == alertResolved:
+		severity = severityNotice
+	case n.severity() == "critical":
+		severity = severityCritical
+	case n.severity() == "error":
+		severity = severityError
+	}
+
+	keys, messages := n.Keys, n.Items
+	if len(keys) == 0 {
+		keys = []string{""}
+		messages = []string{n.ErrorMessage}
+	}
+
+	for i, key := range keys {
+		fields := itemFields(n, key)
+		fields["alert_type"] = string(n.Type)
+		fields["alert_state"] = string(n.State)
+		fields["alert_severity"] = n.severity()
+		fields["host"] = n.Host
+		fields["apm_server_ip"] = n.APMServerIP
+		if key != "" {
+			fields["item"] = key
+		}
+
+		if err := l.sink.writeLog(severity, "alert", n.title()+": "+strings.TrimSpace(messages[i]), fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// logLine is a log line waiting to be forwarded to the sinks
+type logLine struct {
+	severity int
+	message  string
+}
+
+var (
+	// logLines queues the log lines for the sinks, nil while the logs are not forwarded
+	logLines chan logLine
+	// droppedLogLines counts the log lines which did not fit in the queue since they were last reported
+	droppedLogLines int64
+)
+
+// logInfo prints an operational log line like fmt.Println, and forwards it to the log sinks with the info severity
+func logInfo(a ...interface{}) {
+	writeLogLine(severityInfo, "INFO", strings.TrimSuffix(fmt.Sprintln(a...), "\n"))
+}
+
+// logInfof prints an operational log line like fmt.Printf, and forwards it to the log sinks with the info severity
+func logInfof(format string, a ...interface{}) {
+	writeLogLine(severityInfo, "INFO", fmt.Sprintf(format, a...))
+}
+
+// logError prints an error log line like fmt.Println, and forwards it to the log sinks with the error severity
+func logError(a ...interface{}) {
+	writeLogLine(severityError, "ERROR", strings.TrimSuffix(fmt.Sprintln(a...), "\n"))
+}
+
+// logErrorf prints an error log line like fmt.Printf, and forwards it to the log sinks with the error severity
+func logErrorf(format string, a ...interface{}) {
+	writeLogLine(severityError, "ERROR", fmt.Sprintf(format, a...))
+}
+
+// writeLogLine prints the line to the stdout, then queues it for the sinks.
+// A line which does not fit in the queue is dropped, so a slow or unreachable sink never blocks admon.
+func writeLogLine(severity int, level, message string) {
+	fmt.Println(level + ": " + message)
+
+	message = strings.TrimSpace(message)
+	if logLines == nil || message == "" {
+		return
+	}
+	select {
+	case logLines <- logLine{severity: severity, message: message}:
+	default:
+		atomic.AddInt64(&droppedLogLines, 1)
+	}
+}
+
+// forwardLogs starts writing the queued log lines into the sinks.
+// Its own errors are only printed to the stdout, forwarding them would loop.
+func forwardLogs(sinks []logSink) {
+	lines := make(chan logLine, logQueueSize)
+	go func() {
+		for line := range lines {
+			if dropped := atomic.SwapInt64(&droppedLogLines, 0); dropped > 0 {
+				fmt.Printf("ERROR: %d log lines were not forwarded, the log sinks are too slow\n", dropped)
+			}
+			for _, sink := range sinks {
+				if err := sink.writeLog(line.severity, "log", line.message, nil); err != nil {
+					fmt.Println("ERROR: Cannot forward the log line. Because: ", err.Error())
+				}
+			}
+		}
+	}()
+	logLines = lines
+}
+
+// stdoutIsJournal tells whether systemd connects the stdout to the journal, as told by the JOURNAL_STREAM variable
+func stdoutIsJournal() bool {
+	stream := os.Getenv("JOURNAL_STREAM")
+	if stream == "" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && stream == fmt.Sprintf("%d:%d", stat.Dev, stat.Ino)
+}
+
+// startLogForwarding forwards the operational logs to the syslog and/or the systemd journal when enabled
+func startLogForwarding(configData adMonConfig) error {
+	sinks := []logSink{}
+	if configData.Syslog.Logs {
+		sink, err := newSyslogWriter(configData.Syslog)
+		if err != nil {
+			fmt.Println("ERROR: Cannot connect to the syslog")
+			return err
+		}
+		sinks = append(sinks, sink)
+	}
+	if configData.Journald.Logs && stdoutIsJournal() {
+		fmt.Println("INFO: The stdout already goes to the systemd journal, the logs are not written to it twice")
+	} else if configData.Journald.Logs {
+		sink, err := newJournalWriter(configData.Journald)
+		if err != nil {
+			fmt.Println("ERROR: Cannot connect to the systemd journal")
+			return err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if len(sinks) > 0 {
+		forwardLogs(sinks)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+const (
+	templatesDirName = "templates"
+	// defaultTemplateName is the name of the template files used for the alert types without their own files
+	defaultTemplateName = "default"
+)
+
+// mailTemplateFuncs are the functions available in the email templates
+var mailTemplateFuncs = texttemplate.FuncMap{
+	"trim":  strings.TrimSpace,
+	"upper": strings.ToUpper,
+	"join":  strings.Join,
+}
+
+// mailTemplates holds the html & text templates of every alert type
+type mailTemplates struct {
+	html map[alertType]*template.Template
+	text map[alertType]*texttemplate.Template
+}
+
+// loadMailTemplates loads the '<alert type>.html' and '<alert type>.txt' files of the templates directory,
+// falling back to the 'default.html' / 'default.txt' files, then to the built-in templates
+func loadMailTemplates(dir string) (*mailTemplates, error) {
+	templates := &mailTemplates{
+		html: map[alertType]*template.Template{},
+		text: map[alertType]*texttemplate.Template{},
+	}
+
+	for _, alert := range alertTypes {
+		htmlSource, err := readTemplateFile(dir, alert, ".html", builtinMailTemplate(alert))
+		if err != nil {
+			return nil, err
+		}
+		htmlTemplate, err := template.New(string(alert) + ".html").Funcs(template.FuncMap(mailTemplateFuncs)).Parse(htmlSource)
+		if err != nil {
+			logErrorf("Cannot parse the %s email template", alert)
+			return nil, err
+		}
+		templates.html[alert] = htmlTemplate
+
+		textSource, err := readTemplateFile(dir, alert, ".txt", textMailTemplate)
+		if err != nil {
+			return nil, err
+		}
+		textTemplate, err := texttemplate.New(string(alert) + ".txt").Funcs(mailTemplateFuncs).Parse(textSource)
+		if err != nil {
+			logErrorf("Cannot parse the %s text email template", alert)
+			return nil, err
+		}
+		templates.text[alert] = textTemplate
+	}
+
+	return templates, nil
+}
+
+func readTemplateFile(dir string, alert alertType, extension, builtin string) (string, error) {
+	for _, name := range []string{string(alert), defaultTemplateName} {
+		source, err := ioutil.ReadFile(filepath.Join(dir, name+extension))
+		if err == nil {
+			logInfof("Using the email template at '%s' for the %s alerts", filepath.Join(dir, name+extension), alert)
+			return string(source), nil
+		} else if !os.IsNotExist(err) {
+			logErrorf("Cannot read the email template at '%s'", filepath.Join(dir, name+extension))
+			return "", err
+		}
+	}
+	return builtin, nil
+}
+
+// builtinMailTemplate is the html template compiled into admon for the alert type
+func builtinMailTemplate(alert alertType) string {
+	switch alert {
+	case systemAlert, containerResourceAlert:
+		return sysAlertMailTemplate
+	case errorAlert:
+		return errorMailTemplate
+	default:
+		return alertMailTemplate
+	}
+}
+
+// mailData is the data of the email templates.
+// The notification fields (.Type, .State, .Items, .Summary ...) are available as well.
+type mailData struct {
+	notification
+	Title     string
+	Severity  string
+	Hostname  string
+	Resolved  bool
+	AlertID   string
+	Timestamp string
+	Entries   []mailEntry
+}
+
+// mailEntry describes a single item of the notification
+type mailEntry struct {
+	Key        string
+	Message    string
+	Container  string
+	Resource   string
+	Mountpoint string
+	Path       string
+	// Value, Threshold & Peak are only set for the threshold based alerts
+	Value     string
+	Threshold string
+	Peak      string
+}
+
+func newMailData(n notification) mailData {
+	data := mailData{
+		notification: n,
+		Title:        n.title(),
+		Severity:     n.severity(),
+		Hostname:     n.Host,
+		Resolved:     n.State == alertResolved,
+		AlertID:      alertID(n),
+		Timestamp:    n.Time.Format(time.RFC1123),
+	}
+
+	for i, key := range n.Keys {
+		fields := itemFields(n, key)
+		entry := mailEntry{
+			Key:        key,
+			Container:  fields["container"],
+			Resource:   fields["resource"],
+			Mountpoint: fields["mountpoint"],
+			Path:       fields["path"],
+		}
+		if i < len(n.Items) {
+			entry.Message = n.Items[i]
+		}
+		if i < len(n.Values) {
+			entry.Value = n.Values[i].Value
+			entry.Threshold = n.Values[i].Threshold
+			entry.Peak = n.Values[i].Peak
+		}
+		data.Entries = append(data.Entries, entry)
+	}
+	return data
+}
@@ -18,11 +18,15 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/docker/docker/api/types/events"
 	"github.com/integrii/flaggy"
 )
 
@@ -34,14 +38,33 @@ var (
 	BuildID          = "0"
 	dockerAPIVersion = "1.41"
 	configFileName   = "admon.yml"
-	stateFile        = ".admon.state"
-	lastErrorFile    = ".admon.lasterror"
 	configDir        = "."
 	containerNetwork = "all"
 	runNow           = false
+	outboxCmd        *flaggy.Subcommand
+	historyCmd       *flaggy.Subcommand
+	historySince     = "24h"
+	historyUntil     = ""
+	historyTypes     = []string{}
+	historyItem      = ""
+	historyOutput    = "table"
+	silenceCmd       *flaggy.Subcommand
+	silenceAddCmd    *flaggy.Subcommand
+	silenceListCmd   *flaggy.Subcommand
+	silenceRemoveCmd *flaggy.Subcommand
+	silenceMatch     = routeMatch{}
+	silenceAll       = false
+	silenceStart     = ""
+	silenceEnd       = ""
+	silenceDuration  = ""
+	silenceComment   = ""
+	silenceID        = ""
+	silenceOutput    = "table"
 )
 
-func init() {
+// setup parses the command line and initialises the config directory. It runs first thing in main rather than
+// in an init function, so the tests of the package don't need a config directory.
+func setup() {
 	flaggy.SetName("Acceldata Admon")
 	flaggy.SetDescription("Monitors the running containers and system resources in the local machine and sends alerts")
 
@@ -60,6 +83,45 @@ func init() {
 	flaggy.Bool(&runNow, "r", "run", "Runs the daemon")
 	flaggy.String(&containerNetwork, "n", "network", "Container network name")
 
+	//
+	outboxCmd = flaggy.NewSubcommand("outbox")
+	outboxCmd.Description = "Lists the notifications waiting to be re-sent"
+	flaggy.AttachSubcommand(outboxCmd, 1)
+
+	//
+	historyCmd = flaggy.NewSubcommand("history")
+	historyCmd.Description = "Lists the alert events: fired, renotified, snoozed, resolved and delivery failures"
+	historyCmd.String(&historySince, "s", "since", "Lists the events since a duration ago (e.g. 2h, 7d), a date or an RFC 3339 time")
+	historyCmd.String(&historyUntil, "u", "until", "Lists the events until a duration ago, a date or an RFC 3339 time")
+	historyCmd.StringSlice(&historyTypes, "t", "type", "Lists the events of the alert type, can be repeated")
+	historyCmd.String(&historyItem, "i", "item", "Lists the events of the item (container, resource ...), glob patterns are allowed")
+	historyCmd.String(&historyOutput, "o", "output", "Output format: table or json")
+	flaggy.AttachSubcommand(historyCmd, 1)
+
+	//
+	silenceCmd = flaggy.NewSubcommand("silence")
+	silenceCmd.Description = "Manages the silences muting the alerts, e.g. during an upgrade"
+	silenceAddCmd = flaggy.NewSubcommand("add")
+	silenceAddCmd.Description = "Silences the alerts matching all the given criteria"
+	silenceAddCmd.StringSlice(&silenceMatch.Types, "t", "type", "Silences the alert type, can be repeated")
+	silenceAddCmd.StringSlice(&silenceMatch.Containers, "C", "container", "Silences the container, glob patterns are allowed, can be repeated")
+	silenceAddCmd.StringSlice(&silenceMatch.Mountpoints, "m", "mountpoint", "Silences the disk mount point, glob patterns are allowed, can be repeated")
+	silenceAddCmd.Bool(&silenceAll, "a", "all", "Silences all the alerts")
+	silenceAddCmd.String(&silenceStart, "s", "start", "Start of the silence as a date or an RFC 3339 time (default: now)")
+	silenceAddCmd.String(&silenceEnd, "e", "end", "End of the silence as a date or an RFC 3339 time")
+	silenceAddCmd.String(&silenceDuration, "d", "duration", "Duration of the silence from its start, e.g. 2h or 1d")
+	silenceAddCmd.String(&silenceComment, "", "comment", "Why the alerts are silenced")
+	silenceCmd.AttachSubcommand(silenceAddCmd, 1)
+	silenceListCmd = flaggy.NewSubcommand("list")
+	silenceListCmd.Description = "Lists the silences and the maintenance windows"
+	silenceListCmd.String(&silenceOutput, "o", "output", "Output format: table or json")
+	silenceCmd.AttachSubcommand(silenceListCmd, 1)
+	silenceRemoveCmd = flaggy.NewSubcommand("remove")
+	silenceRemoveCmd.Description = "Removes a silence, ending it right away"
+	silenceRemoveCmd.AddPositionalValue(&silenceID, "id", 1, true, "ID of the silence")
+	silenceCmd.AttachSubcommand(silenceRemoveCmd, 1)
+	flaggy.AttachSubcommand(silenceCmd, 1)
+
 	//
 	flaggy.Parse()
 
@@ -68,12 +130,12 @@ func init() {
 	if strings.TrimSpace(configDir) != "" {
 		configDirInfo, err := os.Stat(configDir)
 		if err != nil {
-			fmt.Printf("ERROR: cannot find / access the directory %q because %s\n", configDir, err.Error())
+			logErrorf("cannot find / access the directory %q because %s", configDir, err.Error())
 			os.Exit(1)
 		}
 
 		if !configDirInfo.IsDir() {
-			fmt.Printf("ERROR: the path %q is not a directory\n", configDir)
+			logErrorf("the path %q is not a directory", configDir)
 			os.Exit(1)
 		}
 
@@ -81,12 +143,12 @@ func init() {
 		configDir = configDirEnv
 		configDirEnvInfo, err := os.Stat(configDirEnv)
 		if err != nil {
-			fmt.Printf("ERROR: cannot find / access the directory %q because %s\n", configDirEnv, err.Error())
+			logErrorf("cannot find / access the directory %q because %s", configDirEnv, err.Error())
 			os.Exit(1)
 		}
 
 		if !configDirEnvInfo.IsDir() {
-			fmt.Printf("ERROR: the path %q is not a directory\n", configDir)
+			logErrorf("the path %q is not a directory", configDir)
 			os.Exit(1)
 		}
 	} else {
@@ -98,29 +160,89 @@ func init() {
 }
 
 func main() {
+	setup()
+
+	//
+	if outboxCmd.Used {
+		if err := printOutbox(filepath.Join(configDir, outboxDirName)); err != nil {
+			logError("Cannot read the outbox. Because:", err.Error())
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	//
+	if historyCmd.Used {
+		if err := runHistoryCommand(); err != nil {
+			logError("Cannot list the alert history. Because:", err.Error())
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	//
+	if silenceCmd.Used {
+		if err := runSilenceCommand(); err != nil {
+			logError(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	//
 	if !runNow {
-		fmt.Println("INFO: Pass the '-r' flag to run the daemon!")
-		fmt.Println("INFO: Pass the '-h' flag to see help")
+		logInfo("Pass the '-r' flag to run the daemon!")
+		logInfo("Pass the '-h' flag to see help")
 		os.Exit(0)
 	}
 
 	//
 	configData, err := parseConfig(configDir, configFileName)
 	if err != nil {
-		fmt.Println("ERROR: ", err)
+		logError(err)
 		os.Exit(1)
 	}
-	containerNetwork := configData.Network
-	containersToCheck := configData.Containers
-	slackTeamURL := configData.SlackTeamURL
 	checkInterval := configData.CheckInterval
-	snoozeTime := configData.SnoozeTime
+
+	//
+	if err := startLogForwarding(configData); err != nil {
+		logError(err)
+		os.Exit(1)
+	}
+
+	//
+	if err := validateSelectors(configData.ContainerSelectors); err != nil {
+		logError(err)
+		os.Exit(1)
+	}
+
+	//
+	if err := validateMaintenanceWindows(configData.MaintenanceWindows); err != nil {
+		logError(err)
+		os.Exit(1)
+	}
+
+	//
+	notifiers, err := newDispatcher(configData)
+	if err != nil {
+		logError(err)
+		os.Exit(1)
+	}
+
+	// Outbox Retrier - runs in a goroutine
+	go notifiers.retryQueued()
+
+	//
+	// A state file which cannot be loaded is notified about, admon goes on with an empty state
+	store, err := openStateStore(configDir)
+	if err != nil {
+		notifyError(notifiers, store, configData, fmt.Sprintf("Cannot load the alert state. Because: '%s'", err.Error()))
+	}
 
 	// System Metrics Checker - runs in a goroutine
 	go func() {
 		//
-		fmt.Println("INFO: Initialised System Metric Checker ..")
+		logInfo("Initialised System Metric Checker ..")
 		ticker := time.NewTicker(time.Duration(configData.SysConfig.CheckInterval) * time.Second)
 		watcher := sysWatcher{
 			cpuStatInterval: configData.SysConfig.CPUStatInterval,
@@ -129,297 +251,360 @@ func main() {
 			diskThreshold:   configData.SysConfig.DiskThreshold,
 			dirThreshold:    configData.SysConfig.DirThreshold,
 		}
-		// Initialise Alert Timers & Snooze Timers
-		lastMailEpoch := time.Date(2020, time.April, 15, 0, 0, 0, 0, time.UTC)
-		nextMailEpoch := time.Date(2020, time.April, 15, 0, 0, 0, 0, time.UTC)
-		isFirstMail := true
-		previousMessageLength := 0
+		alerter := newThresholdAlerter(systemAlert, newEscalationPolicy(configData, systemAlert, configData.SysConfig.SnoozeTime), store)
 		//
 		for ; true; <-ticker.C {
-			messages := watcher.watchSystemResources()
-			//
-			if len(messages) > 0 {
-
-				fmt.Println("INFO: System Resources Reached Threshold ...")
-				fmt.Println("INFO: ", messages)
-
-				//
-				currentTime := time.Unix(time.Now().Unix(), 0)
-
-				// TODO: Needs a better logic -
-				// Checks if it's sending the mail for the first time since the startup
-				// If not checks if it reachs the beyond the snooze time
-				// If not checks if the message length is changed compare to the previous message
-				// Each message signifies some change in the state. But it doesn't mean changes are distinct
-				// So this logic needs to be improved to check if the state is actually changed before sending an email
-				if isFirstMail || (currentTime.After(nextMailEpoch) || previousMessageLength != len(messages)) {
-					// send mail
-					newMailConfig := mailConfig{
-						SMTP:              configData.SMTP,
-						MissingContainers: messages,
-						SlackTeamURL:      slackTeamURL,
-						APMServerIP:       configData.APMServerIP,
-					}
-
-					//
-					fmt.Println("INFO: Trying to send the email ... ")
-					if err := sendSysAlert(newMailConfig); err != nil {
-						fmt.Println("ERROR:", err.Error())
-					} else {
-						fmt.Println("INFO: Email Sent!")
-						isFirstMail = false
-						lastMailEpoch = time.Unix(time.Now().Unix(), 0)
-						nextMailEpoch = lastMailEpoch.Add(time.Duration(configData.SysConfig.SnoozeTime) * time.Second)
-						previousMessageLength = len(messages)
-					}
-				} else {
-					// Snooze
-					waitTime := time.Unix(nextMailEpoch.Unix(), 0)
-					fmt.Printf("INFO: Snoozing until - '%s'. Current time is: '%s'\n", waitTime.Format("2006-01-02T15:04:05.000Z"), time.Unix(time.Now().Unix(), 0).Format("2006-01-02T15:04:05.000Z"))
-				}
-			}
+			findings, unknown := watcher.watchSystemResources()
+			alerter.process(notifiers, configData, findings, unknown)
 		}
 	}()
 
+	//
+	cli, err := newDockerClient(dockerAPIVersion)
+	if err != nil {
+		logError(err)
+		os.Exit(1)
+	}
+	defer cli.Close()
+	checker := newContainerChecker(cli, notifiers, store, configData)
+
+	// Docker Events Watcher - runs in a goroutine when enabled
+	dockerEvents := make(chan events.Message, eventsBufferSize)
+	if configData.EventMonitoring {
+		go watchDockerEvents(cli, configData, dockerEvents)
+	}
+
 	for {
+		checker.check()
+
+		// Waits for the check interval, or checks right away on a docker event about the monitored containers
+		timer := time.NewTimer(time.Duration(checkInterval) * time.Second)
+		select {
+		case <-timer.C:
+		case event := <-dockerEvents:
+			timer.Stop()
+			checker.handleEvents(collectEvents(event, dockerEvents))
+		}
+	}
+}
 
-		//
-		fmt.Printf("INFO: Looking for containers in %q network ...\n", containerNetwork)
-		missingContainers := []string{}
+// runHistoryCommand prints the alert history filtered by the flags of the 'history' command
+func runHistoryCommand() error {
+	now := time.Now()
+	since, err := parseHistoryTime(historySince, now, false)
+	if err != nil {
+		return err
+	}
+	until, err := parseHistoryTime(historyUntil, now, true)
+	if err != nil {
+		return err
+	}
 
-		stack, err := getRunningContainers(dockerAPIVersion, containerNetwork)
-		if err == nil {
-			missingContainers = sliceDiff(containersToCheck, stack)
-		} else {
-			fmt.Println("ERROR: Cannot get running containers. Because: ", err.Error())
-			fmt.Println("INFO: Taking it as, all the containers are missing ...")
-			missingContainers = containersToCheck
+	filter := historyFilter{since: since, until: until, item: historyItem}
+	for _, alert := range historyTypes {
+		for _, name := range strings.Split(alert, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				filter.types = append(filter.types, name)
+			}
 		}
-		if len(missingContainers) > 0 {
-			//
-			fmt.Println("INFO: Missing Containers: ", missingContainers)
-
-			//
-			lastState, isFirstRun, err := getState(configDir, stateFile, missingContainers)
-			if err == nil {
-				//
-				if !isFirstRun {
-					// Compare States
-					newState, toMail := compareStates(snoozeTime, lastState, getCurrentState(missingContainers))
-
-					err := writeState(configDir, stateFile, newState)
-					if err == nil {
-						if toMail {
-							// send mail
-							newMailConfig := mailConfig{
-								SMTP:              configData.SMTP,
-								MissingContainers: missingContainers,
-								SlackTeamURL:      slackTeamURL,
-								APMServerIP:       configData.APMServerIP,
-							}
-
-							//
-							fmt.Println("INFO: Trying to send the email ... ")
-							if err := sendAlertMail(newMailConfig); err != nil {
-								fmt.Println("ERROR:", err.Error())
-							} else {
-								fmt.Println("INFO: Email Sent!")
-							}
-						} else {
-							fmt.Println("INFO: Snoozing ..")
-						}
-					} else {
-						//
-						errMsg := fmt.Sprintf("Cannot write to the state file at '%s'. Because: '%s'", configDir+"/tmp/"+stateFile, err.Error())
-						fmt.Println("ERROR: ", errMsg)
-
-						// Send mail
-						newMailConfig := mailConfig{
-							SMTP:         configData.SMTP,
-							SlackTeamURL: slackTeamURL,
-							APMServerIP:  configData.APMServerIP,
-							ErrorMessage: errMsg,
-						}
-
-						//
-						lastErrorTime, isNewError, err := getLastError(configDir, stateFile)
-						if err != nil {
-							fmt.Println("ERROR: Cannot check last error time. Because: ", err.Error())
-						} else {
-							if isNewError {
-								fmt.Println("INFO: Trying to send the email ... ")
-								if err := sendErrorMail(newMailConfig); err != nil {
-									fmt.Println("ERROR: ", err.Error())
-								} else {
-									fmt.Println("INFO: Email Sent!")
-								}
-							} else {
-								//
-								if time.Now().Unix() >= time.Unix(lastErrorTime, 0).Add(time.Duration(snoozeTime)*time.Second).Unix() {
-									//
-									fmt.Println("INFO: Trying to send the email ... ")
-									if err := sendErrorMail(newMailConfig); err != nil {
-										fmt.Println("ERROR: ", err.Error())
-									} else {
-										fmt.Println("INFO: Email Sent!")
-									}
-								} else {
-									fmt.Println("INFO: Snoozing!")
-								}
-							}
-						}
-					}
-				} else {
-					// This is the first run
-					fmt.Println("INFO: This is first time I see containers missing!")
-					err := writeState(configDir, stateFile, lastState)
-					if err == nil {
-
-						// Send Email
-						newMailConfig := mailConfig{
-							SMTP:              configData.SMTP,
-							MissingContainers: missingContainers,
-							SlackTeamURL:      slackTeamURL,
-							APMServerIP:       configData.APMServerIP,
-						}
-
-						//
-						fmt.Println("INFO: Trying to send the email ... ")
-						if err := sendAlertMail(newMailConfig); err != nil {
-							fmt.Println("ERROR: ", err.Error())
-						} else {
-							fmt.Println("INFO: Email Sent!")
-						}
-					} else {
-						//
-						errMsg := fmt.Sprintf("Cannot write to the state file at '%s'. Because: '%s'", configDir+"/tmp/"+stateFile, err.Error())
-						fmt.Println("ERROR: ", errMsg)
-
-						// Send mail
-						newMailConfig := mailConfig{
-							SMTP:         configData.SMTP,
-							SlackTeamURL: slackTeamURL,
-							APMServerIP:  configData.APMServerIP,
-							ErrorMessage: errMsg,
-						}
-
-						//
-						lastErrorTime, isNewError, err := getLastError(configDir, stateFile)
-						if err != nil {
-							fmt.Println("ERROR: Cannot check last error time. Because: ", err.Error())
-						} else {
-							if isNewError {
-								fmt.Println("INFO: Trying to send the email ... ")
-								if err := sendErrorMail(newMailConfig); err != nil {
-									fmt.Println("ERROR: ", err.Error())
-								} else {
-									fmt.Println("INFO: Email Sent!")
-								}
-							} else {
-								//
-								if time.Now().Unix() >= time.Unix(lastErrorTime, 0).Add(time.Duration(snoozeTime)*time.Second).Unix() {
-									//
-									fmt.Println("INFO: Trying to send the email ... ")
-									if err := sendErrorMail(newMailConfig); err != nil {
-										fmt.Println("ERROR: ", err.Error())
-									} else {
-										fmt.Println("INFO: Email Sent!")
-									}
-								} else {
-									fmt.Println("INFO: Snoozing!")
-								}
-							}
-						}
-					}
-				}
-			} else {
-				//
-				errMsg := fmt.Sprintf("Cannot get the state file at '%s'. Because: '%s'", configDir+"/tmp/"+stateFile, err.Error())
-				fmt.Println("ERROR: ", errMsg)
-
-				// Send mail
-				newMailConfig := mailConfig{
-					SMTP:         configData.SMTP,
-					SlackTeamURL: slackTeamURL,
-					APMServerIP:  configData.APMServerIP,
-					ErrorMessage: errMsg,
-				}
+	}
+	for _, alert := range filter.types {
+		if !containsString(alertTypeNames(), alert) {
+			return fmt.Errorf("unknown alert type '%s'. Supported types: %s", alert, strings.Join(alertTypeNames(), ", "))
+		}
+	}
+
+	return printHistory(filepath.Join(configDir, historyDirName), filter, historyOutput)
+}
 
-				//
-				lastErrorTime, isNewError, err := getLastError(configDir, stateFile)
-				if err != nil {
-					fmt.Println("ERROR: Cannot check last error time. Because: ", err.Error())
-				} else {
-					if isNewError {
-						fmt.Println("INFO: Trying to send the email ... ")
-						if err := sendErrorMail(newMailConfig); err != nil {
-							fmt.Println("ERROR: ", err.Error())
-						} else {
-							fmt.Println("INFO: Email Sent!")
-						}
-					} else {
-						//
-						if time.Now().Unix() >= time.Unix(lastErrorTime, 0).Add(time.Duration(snoozeTime)*time.Second).Unix() {
-							//
-							fmt.Println("INFO: Trying to send the email ... ")
-							if err := sendErrorMail(newMailConfig); err != nil {
-								fmt.Println("ERROR: ", err.Error())
-							} else {
-								fmt.Println("INFO: Email Sent!")
-							}
-						} else {
-							fmt.Println("INFO: Snoozing!")
-						}
-					}
+// runSilenceCommand adds, lists or removes the silences kept in the state store
+func runSilenceCommand() error {
+	store, err := openStateStore(configDir)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case silenceAddCmd.Used:
+		start := time.Now()
+		if silenceStart != "" {
+			if start, err = parseDate(silenceStart); err != nil {
+				return err
+			}
+		}
+
+		var end time.Time
+		switch {
+		case silenceEnd != "" && silenceDuration != "":
+			return errors.New("pass either '--end' or '--duration', not both")
+		case silenceEnd != "":
+			if end, err = parseDate(silenceEnd); err != nil {
+				return err
+			}
+		case silenceDuration != "":
+			duration, err := parseDuration(silenceDuration)
+			if err != nil {
+				return fmt.Errorf("invalid duration '%s'. Use a duration like '90m', '2h' or '1d'", silenceDuration)
+			}
+			end = start.Add(duration)
+		default:
+			return errors.New("pass '--end' or '--duration' to set when the silence is over")
+		}
+
+		s, err := newSilence(silenceMatch, silenceAll, start, end, silenceComment)
+		if err != nil {
+			return err
+		}
+		if err := store.updateSilences(func(silences []silence) ([]silence, error) {
+			return append(silences, s), nil
+		}); err != nil {
+			return err
+		}
+		logInfof("Added the silence '%s' (%s) from '%s' to '%s'", s.ID, describeMatch(s.Match), s.Start.Local().Format("2006-01-02 15:04"), s.End.Local().Format("2006-01-02 15:04"))
+
+	case silenceRemoveCmd.Used:
+		if err := store.updateSilences(func(silences []silence) ([]silence, error) {
+			for i, s := range silences {
+				if s.ID == silenceID {
+					return append(silences[:i], silences[i+1:]...), nil
 				}
 			}
+			return nil, fmt.Errorf("no silence with the ID '%s'", silenceID)
+		}); err != nil {
+			return err
+		}
+		logInfof("Removed the silence '%s'", silenceID)
+
+	default:
+		// The maintenance windows are listed too, when the config can be read
+		windows := []maintenanceWindow{}
+		if configData, err := parseConfig(configDir, configFileName); err == nil {
+			if err := validateMaintenanceWindows(configData.MaintenanceWindows); err != nil {
+				return err
+			}
+			windows = configData.MaintenanceWindows
+		}
+		return printSilences(store.silences(), windows, silenceOutput)
+	}
+	return nil
+}
+
+// checkTrackedAlert runs the snooze & recovery logic for an alert tracking individual items, e.g. containers.
+// 'failing' maps the failing items to their alert messages.
+// It returns true when no item is failing and the state is updated successfully.
+func checkTrackedAlert(notifiers *dispatcher, store *stateStore, configData adMonConfig, alert alertType, failing map[string]string) bool {
+	//
+	failingContainers := []string{}
+	for container := range failing {
+		failingContainers = append(failingContainers, container)
+	}
+	sort.Strings(failingContainers)
+
+	//
+	lastState := store.items(alert)
+	if len(lastState) == 0 && alert == containerAlert && len(failingContainers) > 0 {
+		logInfo("This is first time I see containers missing!")
+	}
+
+	// The silenced items are tracked, so they get resolved, but they are neither notified nor counted as notified
+	recovered := recoveredContainers(lastState, failingContainers)
+	silenced := silencedItems(store, configData, notification{Type: alert, Keys: append(append([]string{}, failingContainers...), sortedKeys(recovered)...)}, time.Now())
+	notifiable := []string{}
+	for _, container := range failingContainers {
+		if _, ok := silenced[container]; !ok {
+			notifiable = append(notifiable, container)
+		}
+	}
+
+	// Compare States
+	policy := newEscalationPolicy(configData, alert, configData.SnoozeTime)
+	newState, due := compareStates(policy, lastState, getCurrentState(notifiable))
+	toMail := len(due) > 0
+	// Only the due items count as notified, so each item follows its own repeat & escalation schedule
+	for _, container := range due {
+		newState[container] = newState[container].notified()
+	}
+	for container := range failing {
+		if _, ok := silenced[container]; !ok {
+			continue
+		}
+		if state, ok := lastState[container]; ok {
+			newState[container] = state
 		} else {
-			// Write empty state
-			if err := writeState(configDir, stateFile, map[string]int64{}); err != nil {
-				errMsg := fmt.Sprintf("Containers are running fine. But, cannot write to the state file at '%s'. Because: '%s'", configDir+"/tmp/"+stateFile, err.Error())
-				fmt.Println("ERROR: ", errMsg)
-
-				// Send mail
-				newMailConfig := mailConfig{
-					SMTP:         configData.SMTP,
-					SlackTeamURL: slackTeamURL,
-					APMServerIP:  configData.APMServerIP,
-					ErrorMessage: errMsg,
-				}
+			newState[container] = itemState{FirstSeen: time.Now().Unix()}
+		}
+	}
 
-				//
-				lastErrorTime, isNewError, err := getLastError(configDir, stateFile)
-				if err != nil {
-					fmt.Println("ERROR: Cannot check last error time. Because: ", err.Error())
-				} else {
-					if isNewError {
-						fmt.Println("INFO: Trying to send the email ... ")
-						if err := sendErrorMail(newMailConfig); err != nil {
-							fmt.Println("ERROR: ", err.Error())
-						} else {
-							fmt.Println("INFO: Email Sent!")
-						}
-					} else {
-						//
-						if time.Now().Unix() >= time.Unix(lastErrorTime, 0).Add(time.Duration(snoozeTime)*time.Second).Unix() {
-							//
-							fmt.Println("INFO: Trying to send the email ... ")
-							if err := sendErrorMail(newMailConfig); err != nil {
-								fmt.Println("ERROR: ", err.Error())
-							} else {
-								fmt.Println("INFO: Email Sent!")
-							}
-						} else {
-							fmt.Println("INFO: Snoozing!")
-						}
-					}
-				}
-			} else {
-				fmt.Println("INFO: Everything Looks Good!")
+	// The alerts are sent even when the state cannot be saved, the state kept in memory snoozes them like the saved one
+	saved := true
+	if err := store.setItems(alert, newState); err != nil {
+		//
+		errMsg := fmt.Sprintf("Cannot write to the state file at '%s'. Because: '%s'", store.path, err.Error())
+		notifyError(notifiers, store, configData, errMsg)
+		saved = false
+	}
+
+	// Tells apart the newly failing items from the still failing ones, and the due items from the snoozed ones
+	now := time.Now().Unix()
+	condition := failingCondition(alert)
+	messages, newItems, stillFailing := []string{}, []string{}, []string{}
+	// firstNotified are the items notified for the first time, including the ones silenced so far
+	firstNotified := map[string]bool{}
+	dueIndexes, snoozedIndexes, silencedIndexes := []int{}, []int{}, []int{}
+	for i, container := range failingContainers {
+		last, wasFailing := lastState[container]
+		messages = append(messages, failingMessage(failing[container], condition, newState[container], !wasFailing, now))
+		if _, ok := silenced[container]; ok {
+			silencedIndexes = append(silencedIndexes, i)
+			continue
+		}
+		if !containsString(due, container) {
+			snoozedIndexes = append(snoozedIndexes, i)
+			continue
+		}
+
+		dueIndexes = append(dueIndexes, i)
+		if wasFailing {
+			stillFailing = append(stillFailing, container)
+		} else {
+			newItems = append(newItems, container)
+		}
+		firstNotified[container] = !wasFailing || last.LastNotified == 0
+	}
+
+	failingItems := notification{
+		Type:        alert,
+		APMServerIP: configData.APMServerIP,
+		Items:       messages,
+		Keys:        failingContainers,
+		FirstSeen:   firstSeenTimes(newState, failingContainers),
+	}
+	if len(silencedIndexes) > 0 {
+		logInfof("Silenced (%s): %v", alert, failingItems.subset(silencedIndexes).Keys)
+		notifiers.history.recordSilenced(failingItems.subset(silencedIndexes), silenced)
+	}
+
+	// The snoozed items are only listed as context of the due ones
+	firing, snoozed := failingItems.subset(dueIndexes), failingItems.subset(snoozedIndexes)
+	firing.Snoozed, firing.SnoozedKeys = snoozed.Items, snoozed.Keys
+	if toMail {
+		logInfof("Failing (%s) - new: %v, still %s: %v, snoozed: %v", alert, newItems, condition, stillFailing, snoozed.Keys)
+		notifiers.history.recordFiring(firing, firstNotified)
+
+		// send the alert
+		logInfo("Trying to send the notification ... ")
+		if err := notifiers.dispatch(firing); err != nil {
+			logError(err.Error())
+		} else {
+			logInfo("Notification Sent!")
+		}
+
+		// The items notified too many times are escalated
+		escalated := []int{}
+		for i, container := range firing.Keys {
+			if policy.escalates(newState[container].NotificationCount) {
+				escalated = append(escalated, i)
 			}
 		}
+		if len(escalated) > 0 {
+			logInfof("Escalating (%s) via %v: %v", alert, policy.channels, firing.subset(escalated).Keys)
+			if err := notifiers.escalate(firing.subset(escalated), policy); err != nil {
+				logError(err.Error())
+			}
+		}
+	}
+	if len(snoozed.Keys) > 0 {
+		logInfof("Snoozing (%s): %v", alert, snoozed.Keys)
+		notifiers.history.record(historySnoozed, snoozed, "", nil)
+		notifiers.refresh(snoozed)
+	}
+
+	// The items never notified, as they were silenced while failing, are resolved silently.
+	// The notified ones are resolved even when silenced now, so their incidents & threads get closed.
+	muted := map[string]itemState{}
+	for container, state := range recovered {
+		if state.LastNotified == 0 {
+			muted[container] = state
+			delete(recovered, container)
+		}
+	}
+	if len(muted) > 0 {
+		logInfof("Recovered silently (%s): %v", alert, sortedKeys(muted))
+		notifiers.history.recordSilenced(notification{
+			Type:        alert,
+			State:       alertResolved,
+			APMServerIP: configData.APMServerIP,
+			Items:       recoveryMessages(muted, condition),
+			Keys:        sortedKeys(muted),
+			FirstSeen:   firstSeenTimes(muted, sortedKeys(muted)),
+		}, silenced)
+	}
+
+	if len(recovered) > 0 {
+		resolved := notification{
+			Type:        alert,
+			State:       alertResolved,
+			APMServerIP: configData.APMServerIP,
+			Items:       recoveryMessages(recovered, condition),
+			Keys:        sortedKeys(recovered),
+			FirstSeen:   firstSeenTimes(recovered, sortedKeys(recovered)),
+		}
+		notifiers.history.record(historyResolved, resolved, "", nil)
+
+		// send the recovery notification
+		logInfof("Recovered (%s): %v", alert, sortedKeys(recovered))
+		logInfo("Trying to send the notification ... ")
+		if err := notifiers.dispatch(resolved); err != nil {
+			logError(err.Error())
+		} else {
+			logInfo("Notification Sent!")
+		}
+	}
+
+	return len(failingContainers) == 0 && saved
+}
+
+// notifyError sends an alert about admon's own failures, snoozing the repeated errors
+func notifyError(notifiers *dispatcher, store *stateStore, configData adMonConfig, errMsg string) {
+	logError(errMsg)
+
+	// The errors are tracked by their message, forgetting them once their snooze time is over
+	now := time.Now().Unix()
+	lastErrors := store.items(errorAlert)
+	for message, state := range lastErrors {
+		if now >= time.Unix(state.LastNotified, 0).Add(time.Duration(configData.SnoozeTime)*time.Second).Unix() {
+			delete(lastErrors, message)
+		}
+	}
+
+	//
+	n := notification{
+		Type:         errorAlert,
+		APMServerIP:  configData.APMServerIP,
+		ErrorMessage: errMsg,
+	}
+	if silenced := silencedItems(store, configData, n, time.Now()); len(silenced) > 0 {
+		logInfof("Silenced by the %s", silenced[""])
+		notifiers.history.recordSilenced(n, silenced)
+		return
+	}
+	if _, ok := lastErrors[errMsg]; ok {
+		logInfo("Snoozing!")
+		notifiers.history.record(historySnoozed, n, "", nil)
+		return
+	}
+	notifiers.history.record(historyFired, n, "", nil)
+
+	//
+	logInfo("Trying to send the notification ... ")
+	if err := notifiers.dispatch(n); err != nil {
+		logError(err.Error())
+	} else {
+		logInfo("Notification Sent!")
+	}
 
-		// Check interval
-		time.Sleep(time.Duration(checkInterval) * time.Second)
+	lastErrors[errMsg] = itemState{FirstSeen: now, LastNotified: now}.notified()
+	if err := store.setItems(errorAlert, lastErrors); err != nil {
+		logError("Cannot save the last admon errors. Because:", err.Error())
 	}
 }
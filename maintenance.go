@@ -0,0 +1,189 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronMacros are the shortcuts accepted in place of the 5 cron fields
+var cronMacros = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// cronSchedule is a parsed 'minute hour day-of-month month day-of-week' cron expression, in the local time zone
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays uint64
+	// anyDay & anyWeekday tell whether the day fields are '*', as cron matches either of them when both are restricted
+	anyDay, anyWeekday bool
+}
+
+func parseCronSchedule(spec string) (*cronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if macro, ok := cronMacros[spec]; ok {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("the cron schedule '%s' must have 5 fields: minute hour day-of-month month day-of-week", spec)
+	}
+
+	schedule := &cronSchedule{anyDay: fields[2] == "*", anyWeekday: fields[4] == "*"}
+	var err error
+	if schedule.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if schedule.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if schedule.days, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if schedule.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if schedule.weekdays, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	// Both 0 and 7 are Sunday
+	if schedule.weekdays&(1<<7) != 0 {
+		schedule.weekdays |= 1
+	}
+	return schedule, nil
+}
+
+// parseCronField parses the comma separated values, ranges ('1-5') and steps ('*/15', '0-30/10') of a cron field
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		valueRange, step := part, 1
+		if slash := strings.Index(part, "/"); slash >= 0 {
+			valueRange = part[:slash]
+			parsed, err := strconv.Atoi(part[slash+1:])
+			if err != nil || parsed <= 0 {
+				return 0, fmt.Errorf("invalid step in the cron field '%s'", field)
+			}
+			step = parsed
+		}
+
+		start, end := min, max
+		if valueRange != "*" {
+			bounds := strings.SplitN(valueRange, "-", 2)
+			var err error
+			if start, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value in the cron field '%s'", field)
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid range in the cron field '%s'", field)
+				}
+			} else if step > 1 {
+				// '5/15' means from 5 to the max, every 15
+				end = max
+			}
+		}
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("the cron field '%s' is out of the range %d-%d", field, min, max)
+		}
+
+		for value := start; value <= end; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
+
+// matches tells whether the minute of the time is one of the schedule
+func (c *cronSchedule) matches(t time.Time) bool {
+	t = t.Local()
+	if c.minutes&(1<<uint(t.Minute())) == 0 || c.hours&(1<<uint(t.Hour())) == 0 || c.months&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	dayMatches := c.days&(1<<uint(t.Day())) != 0
+	weekdayMatches := c.weekdays&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.anyDay && c.anyWeekday:
+		return true
+	case c.anyDay:
+		return weekdayMatches
+	case c.anyWeekday:
+		return dayMatches
+	default:
+		return dayMatches || weekdayMatches
+	}
+}
+
+// validateMaintenanceWindows parses the schedules and checks the match criteria of the maintenance windows
+func validateMaintenanceWindows(windows []maintenanceWindow) error {
+	for i := range windows {
+		window := &windows[i]
+		if window.Name == "" {
+			window.Name = fmt.Sprintf("#%d", i+1)
+		}
+
+		schedule, err := parseCronSchedule(window.Schedule)
+		if err != nil {
+			return fmt.Errorf("invalid 'schedule' in the maintenance window '%s': %s", window.Name, err.Error())
+		}
+		window.schedule = schedule
+
+		if window.Duration <= 0 {
+			return fmt.Errorf("the maintenance window '%s' needs a positive 'duration' in seconds", window.Name)
+		}
+		if err := validateMatch(window.Match, fmt.Sprintf("the maintenance window '%s'", window.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// activeSince returns the start of the current occurrence of the window, or the zero time when the window is not active
+func (w maintenanceWindow) activeSince(now time.Time) time.Time {
+	if w.schedule == nil {
+		return time.Time{}
+	}
+
+	minute := now.Truncate(time.Minute)
+	for elapsed := time.Duration(0); elapsed < time.Duration(w.Duration)*time.Second; elapsed += time.Minute {
+		if start := minute.Add(-elapsed); w.schedule.matches(start) {
+			return start
+		}
+	}
+	return time.Time{}
+}
+
+// nextStart returns the next start of the window within a year, or the zero time without one
+func (w maintenanceWindow) nextStart(now time.Time) time.Time {
+	if w.schedule == nil {
+		return time.Time{}
+	}
+
+	start := now.Truncate(time.Minute).Add(time.Minute)
+	for end := now.AddDate(1, 0, 0); start.Before(end); start = start.Add(time.Minute) {
+		if w.schedule.matches(start) {
+			return start
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,159 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// cronBits sets the bits of the given values, like a parsed cron field
+func cronBits(values ...int) uint64 {
+	var bits uint64
+	for _, value := range values {
+		bits |= 1 << uint(value)
+	}
+	return bits
+}
+
+// localTime is a time of the local time zone, the one of the cron schedules
+func localTime(year int, month time.Month, day, hour, minute, second int) time.Time {
+	return time.Date(year, month, day, hour, minute, second, 0, time.Local)
+}
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field    string
+		min, max int
+		want     uint64
+		wantErr  bool
+	}{
+		{field: "*", min: 0, max: 6, want: cronBits(0, 1, 2, 3, 4, 5, 6)},
+		{field: "5", min: 0, max: 59, want: cronBits(5)},
+		{field: "1,15,30", min: 1, max: 31, want: cronBits(1, 15, 30)},
+		{field: "1-5", min: 0, max: 7, want: cronBits(1, 2, 3, 4, 5)},
+		{field: "*/15", min: 0, max: 59, want: cronBits(0, 15, 30, 45)},
+		{field: "0-30/10", min: 0, max: 59, want: cronBits(0, 10, 20, 30)},
+		{field: "5/20", min: 0, max: 59, want: cronBits(5, 25, 45)},
+		{field: "*/5", min: 1, max: 12, want: cronBits(1, 6, 11)},
+		{field: "1-3,22-23", min: 0, max: 23, want: cronBits(1, 2, 3, 22, 23)},
+		{field: "10-20/5,0", min: 0, max: 59, want: cronBits(0, 10, 15, 20)},
+		{field: "60", min: 0, max: 59, wantErr: true},
+		{field: "0", min: 1, max: 31, wantErr: true},
+		{field: "5-1", min: 0, max: 59, wantErr: true},
+		{field: "*/0", min: 0, max: 59, wantErr: true},
+		{field: "*/x", min: 0, max: 59, wantErr: true},
+		{field: "a-b", min: 0, max: 59, wantErr: true},
+		{field: "1-b", min: 0, max: 59, wantErr: true},
+		{field: "", min: 0, max: 59, wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := parseCronField(test.field, test.min, test.max)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseCronField(%q, %d, %d) = %b, want an error", test.field, test.min, test.max, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseCronField(%q, %d, %d) returned the error: %s", test.field, test.min, test.max, err)
+		} else if got != test.want {
+			t.Errorf("parseCronField(%q, %d, %d) = %b, want %b", test.field, test.min, test.max, got, test.want)
+		}
+	}
+}
+
+func TestCronScheduleMatches(t *testing.T) {
+	// 2024-06-01 is a Saturday, 2024-06-02 a Sunday and 2024-06-03 a Monday
+	tests := []struct {
+		schedule string
+		at       time.Time
+		want     bool
+	}{
+		{"0 2 * * *", localTime(2024, 6, 4, 2, 0, 0), true},
+		{"0 2 * * *", localTime(2024, 6, 4, 2, 1, 0), false},
+		{"0 2 * * *", localTime(2024, 6, 4, 3, 0, 0), false},
+		// Both day fields restricted: either of them matches
+		{"0 2 1 * 1", localTime(2024, 6, 1, 2, 0, 0), true},
+		{"0 2 1 * 1", localTime(2024, 6, 3, 2, 0, 0), true},
+		{"0 2 1 * 1", localTime(2024, 6, 4, 2, 0, 0), false},
+		// Only one day field restricted: it must match
+		{"0 2 1 * *", localTime(2024, 6, 3, 2, 0, 0), false},
+		{"0 2 * * 1", localTime(2024, 6, 1, 2, 0, 0), false},
+		{"0 2 * * 1-5", localTime(2024, 6, 3, 2, 0, 0), true},
+		// Both 0 and 7 are Sunday
+		{"0 2 * * 7", localTime(2024, 6, 2, 2, 0, 0), true},
+		{"0 2 * * 0", localTime(2024, 6, 2, 2, 0, 0), true},
+		{"0 2 * 7 *", localTime(2024, 6, 2, 2, 0, 0), false},
+		{"@daily", localTime(2024, 6, 4, 0, 0, 0), true},
+		{"@weekly", localTime(2024, 6, 2, 0, 0, 0), true},
+		{"@monthly", localTime(2024, 6, 2, 0, 0, 0), false},
+	}
+
+	for _, test := range tests {
+		schedule, err := parseCronSchedule(test.schedule)
+		if err != nil {
+			t.Fatalf("parseCronSchedule(%q) returned the error: %s", test.schedule, err)
+		}
+		if got := schedule.matches(test.at); got != test.want {
+			t.Errorf("%q matches %s = %t, want %t", test.schedule, test.at.Format(time.RFC1123), got, test.want)
+		}
+	}
+}
+
+func TestParseCronScheduleErrors(t *testing.T) {
+	for _, spec := range []string{"", "0 2 * *", "0 2 * * * *", "@yearly", "0 24 * * *", "0 2 32 * *", "0 2 * 13 *", "0 2 * * 8"} {
+		if _, err := parseCronSchedule(spec); err == nil {
+			t.Errorf("parseCronSchedule(%q) returned no error", spec)
+		}
+	}
+}
+
+func TestActiveSince(t *testing.T) {
+	mustParse := func(spec string) *cronSchedule {
+		schedule, err := parseCronSchedule(spec)
+		if err != nil {
+			t.Fatalf("parseCronSchedule(%q) returned the error: %s", spec, err)
+		}
+		return schedule
+	}
+	// Every Saturday at 02:00 for 2 hours, 2024-06-01 being a Saturday
+	saturday := maintenanceWindow{Name: "upgrade", Duration: 7200, schedule: mustParse("0 2 * * 6")}
+	lateNight := maintenanceWindow{Name: "backup", Duration: 3600, schedule: mustParse("30 23 * * *")}
+
+	tests := []struct {
+		name   string
+		window maintenanceWindow
+		now    time.Time
+		want   time.Time
+	}{
+		{"before the start", saturday, localTime(2024, 6, 1, 1, 59, 59), time.Time{}},
+		{"at the start", saturday, localTime(2024, 6, 1, 2, 0, 0), localTime(2024, 6, 1, 2, 0, 0)},
+		{"during the window", saturday, localTime(2024, 6, 1, 3, 59, 30), localTime(2024, 6, 1, 2, 0, 0)},
+		{"at the end", saturday, localTime(2024, 6, 1, 4, 0, 0), time.Time{}},
+		{"another day", saturday, localTime(2024, 6, 2, 2, 30, 0), time.Time{}},
+		{"across midnight", lateNight, localTime(2024, 6, 2, 0, 15, 0), localTime(2024, 6, 1, 23, 30, 0)},
+		{"without schedule", maintenanceWindow{Name: "invalid", Duration: 3600}, localTime(2024, 6, 1, 2, 0, 0), time.Time{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.window.activeSince(test.now); !got.Equal(test.want) {
+				t.Errorf("activeSince(%s) = %s, want %s", test.now.Format(time.RFC1123), got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,463 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type alertType string
+
+const (
+	containerAlert alertType = "container"
+	systemAlert    alertType = "system"
+	errorAlert     alertType = "error"
+	healthAlert    alertType = "health"
+	restartAlert   alertType = "restart"
+	daemonAlert    alertType = "daemon"
+	// containerResourceAlert is about the resource usage of a single container
+	containerResourceAlert alertType = "containerResource"
+)
+
+// alertTypes lists all the alert types
+var alertTypes = []alertType{containerAlert, systemAlert, errorAlert, healthAlert, restartAlert, daemonAlert, containerResourceAlert}
+
+type alertState string
+
+const (
+	alertFiring   alertState = "firing"
+	alertResolved alertState = "resolved"
+)
+
+// notification is the channel agnostic payload handed to every notifier
+type notification struct {
+	Type        alertType
+	State       alertState
+	Host        string
+	APMServerIP string
+	Items       []string
+	// Keys identify the items (container names, resources ...) across the notifications, in the same order as the Items
+	Keys         []string
+	ErrorMessage string
+	Time         time.Time
+	// Values are the measured values of the threshold based items, in the same order as the Keys
+	Values []itemValue
+	// FirstSeen are the times the items started failing, in the same order as the Keys
+	FirstSeen []time.Time
+	// Receivers replace the email receivers of the 'smtp' config, when set by the matching route
+	Receivers []string
+	// Snoozed are the messages of the still failing items not due for a notification yet, only listed as context
+	Snoozed []string
+	// SnoozedKeys identify the Snoozed items, in the same order
+	SnoozedKeys []string
+}
+
+// itemValue is the measured value of a threshold based item vs its threshold
+type itemValue struct {
+	Value     string
+	Threshold string
+	// Peak is the highest value seen while the alert was firing, only set in the resolved notifications
+	Peak string
+}
+
+// notifier delivers a notification through a single channel (email, chat, paging ...)
+type notifier interface {
+	name() string
+	notify(n notification) error
+}
+
+// refresher is implemented by the notifiers which expire the alerts not re-sent in time (e.g. Alertmanager),
+// so they get the firing alerts on every check, even while the other channels are snoozed
+type refresher interface {
+	refresh(n notification) error
+}
+
+// notifierRegistry maps the channel names accepted in the 'channels' config
+// property to the constructors of their notifiers
+var notifierRegistry = map[string]func(config adMonConfig) (notifier, error){
+	"email":        newEmailNotifier,
+	"slack":        newSlackNotifier,
+	"pagerduty":    newPagerDutyNotifier,
+	"webhook":      newWebhookNotifier,
+	"teams":        newTeamsNotifier,
+	"alertmanager": newAlertmanagerNotifier,
+	"syslog":       newSyslogNotifier,
+	"journald":     newJournaldNotifier,
+}
+
+// dispatcher fans out a notification to all the configured notifiers
+type dispatcher struct {
+	host      string
+	notifiers []notifier
+	// channels are the default channels, used for the notifications matching no route
+	channels []string
+	routes   []routeConfig
+	// outbox queues the notifications which failed, nil when disabled
+	outbox *outbox
+	// history records the alert events, nil when disabled
+	history *alertHistory
+}
+
+func newDispatcher(config adMonConfig) (*dispatcher, error) {
+	d := &dispatcher{}
+
+	host, err := os.Hostname()
+	if err != nil {
+		logError("Cannot get the hostname. Because:", err.Error())
+		host = config.APMServerIP
+	}
+	d.host = host
+
+	channels := config.Channels
+	if len(channels) == 0 {
+		// Email is the only channel admon knew about before channels were configurable
+		channels = []string{"email"}
+		if strings.TrimSpace(config.SlackTeamURL) != "" {
+			channels = append(channels, "slack")
+		}
+	} else if strings.TrimSpace(config.SlackTeamURL) != "" && !containsString(channels, "slack") {
+		logInfo("The 'slackTeamURL' is set, but the 'slack' channel is not listed in 'channels'. Slack alerts are disabled")
+	}
+
+	if err := validateRoutes(config.Routes); err != nil {
+		return d, err
+	}
+	if err := validateEscalations(config.Escalations); err != nil {
+		return d, err
+	}
+	d.channels, d.routes = channels, config.Routes
+
+	// The routes and the escalations may use the channels not listed in 'channels'
+	allChannels := append([]string{}, channels...)
+	for _, route := range config.Routes {
+		for _, channel := range route.Channels {
+			if !containsString(allChannels, channel) {
+				allChannels = append(allChannels, channel)
+			}
+		}
+	}
+	for _, channel := range escalationChannels(config) {
+		if !containsString(allChannels, channel) {
+			allChannels = append(allChannels, channel)
+		}
+	}
+
+	for _, channel := range allChannels {
+		newNotifier, ok := notifierRegistry[channel]
+		if !ok {
+			return d, fmt.Errorf("unknown notification channel '%s'. Supported channels: %s", channel, strings.Join(registeredChannels(), ", "))
+		}
+
+		n, err := newNotifier(config)
+		if err != nil {
+			logErrorf("Cannot initialise the '%s' notification channel", channel)
+			return d, err
+		}
+		d.notifiers = append(d.notifiers, n)
+	}
+
+	if !config.Outbox.Disabled {
+		o, err := newOutbox(filepath.Join(configDir, outboxDirName), config.Outbox)
+		if err != nil {
+			logError("Cannot initialise the notification outbox")
+			return d, err
+		}
+		d.outbox = o
+	}
+
+	if !config.History.Disabled {
+		h, err := newAlertHistory(filepath.Join(configDir, historyDirName), host, config.History)
+		if err != nil {
+			logError("Cannot initialise the alert history")
+			return d, err
+		}
+		d.history = h
+	}
+
+	return d, nil
+}
+
+// dispatch sends the notification through the channels of the routes its items match, even if some of them fail.
+// It returns an error only when at least one of the channels failed.
+func (d *dispatcher) dispatch(n notification) error {
+	failures := []string{}
+	n = d.complete(n)
+
+	for _, part := range route(n, d.routes, d.channels) {
+		for _, channel := range d.notifiers {
+			if !containsString(part.channels, channel.name()) {
+				continue
+			}
+			if err := d.send(channel, part.n); err != nil {
+				failures = append(failures, channel.name()+": "+err.Error())
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		return errors.New("failed to notify via " + strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// send notifies through a single channel, queueing the notification in the outbox when it fails.
+// The new notification first probes a channel with undelivered notifications, and it is queued behind them
+// only if they still cannot be delivered.
+func (d *dispatcher) send(channel notifier, n notification) error {
+	if d.outbox != nil && d.outbox.pending(channel.name()) {
+		d.outbox.probe(channel, d.history)
+	}
+	if d.outbox != nil && d.outbox.pending(channel.name()) {
+		logInfof("The '%s' channel has undelivered alerts, queueing the %s alert behind them", channel.name(), n.Type)
+		if err := d.outbox.enqueue(channel.name(), n, nil); err != nil {
+			logError("Cannot queue the alert in the outbox. Because:", err.Error())
+			d.history.record(historyDeliveryFailed, n, channel.name(), err)
+			return err
+		}
+		d.history.record(historyQueued, n, channel.name(), nil)
+		return errors.New("queued behind the undelivered alerts")
+	}
+
+	err := channel.notify(n)
+	if err == nil {
+		return nil
+	}
+	logErrorf("Cannot send the %s alert via '%s'. Because: %s", n.Type, channel.name(), err.Error())
+	d.history.record(historyDeliveryFailed, n, channel.name(), err)
+
+	if d.outbox != nil {
+		if err := d.outbox.enqueue(channel.name(), n, err); err != nil {
+			logError("Cannot queue the alert in the outbox. Because:", err.Error())
+		} else {
+			logInfof("Queued the %s alert for a retry via '%s'", n.Type, channel.name())
+		}
+	}
+	return err
+}
+
+// retryQueued keeps retrying the notifications queued in the outbox. It never returns.
+func (d *dispatcher) retryQueued() {
+	if d.outbox == nil {
+		return
+	}
+
+	ticker := time.NewTicker(outboxPollInterval)
+	for ; true; <-ticker.C {
+		d.outbox.retry(d.notifiers, d.history)
+	}
+}
+
+// refresh re-sends the snoozed alerts to the channels which expect the firing alerts on every check
+func (d *dispatcher) refresh(n notification) {
+	n = d.complete(n)
+
+	for _, part := range route(n, d.routes, d.channels) {
+		for _, channel := range d.notifiers {
+			if r, ok := channel.(refresher); ok && containsString(part.channels, channel.name()) {
+				if err := r.refresh(part.n); err != nil {
+					logErrorf("Cannot refresh the %s alert via '%s'. Because: %s", n.Type, channel.name(), err.Error())
+				}
+			}
+		}
+	}
+}
+
+// complete fills the defaults of the notification
+func (d *dispatcher) complete(n notification) notification {
+	if n.Host == "" {
+		n.Host = d.host
+	}
+	if n.State == "" {
+		n.State = alertFiring
+	}
+	if n.Time.IsZero() {
+		n.Time = time.Now()
+	}
+	return n
+}
+
+func registeredChannels() []string {
+	channels := []string{}
+	for channel := range notifierRegistry {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// title is the one line summary of the notification used by the chat like channels
+func (n notification) title() string {
+	resolved := n.State == alertResolved
+	switch n.Type {
+	case containerAlert:
+		if resolved {
+			return "Containers Running Again"
+		}
+		return "Containers Not Running"
+	case healthAlert:
+		if resolved {
+			return "Containers Healthy Again"
+		}
+		return "Unhealthy Containers"
+	case restartAlert:
+		if resolved {
+			return "Containers Stable Again"
+		}
+		return "Containers Restarting Repeatedly"
+	case daemonAlert:
+		if resolved {
+			return "Docker Daemon Reachable Again"
+		}
+		return "Docker Daemon Unreachable"
+	case containerResourceAlert:
+		if resolved {
+			return "Container Resources Back Below Threshold"
+		}
+		return "Container Resources Reached Threshold"
+	case systemAlert:
+		if resolved {
+			return "Server Resources Back Below Threshold"
+		}
+		return "Server Resources Reached Threshold"
+	default:
+		return "Admon Error"
+	}
+}
+
+// severity is the urgency of the notification, using the PagerDuty severity levels
+func (n notification) severity() string {
+	switch n.Type {
+	case containerAlert, daemonAlert:
+		return "critical"
+	case healthAlert, restartAlert, errorAlert:
+		return "error"
+	default:
+		return "warning"
+	}
+}
+
+// itemFields describes the item of a key with the 'container', 'resource', 'mountpoint' or 'path' fields
+func itemFields(n notification, key string) map[string]string {
+	fields := map[string]string{}
+
+	kind, target := key, ""
+	if separator := strings.Index(key, ":"); separator >= 0 {
+		kind, target = key[:separator], key[separator+1:]
+	}
+
+	switch n.Type {
+	case containerAlert, healthAlert, restartAlert:
+		if kind == "selector" {
+			fields["selector"] = target
+			break
+		}
+		fields["container"] = key
+	case containerResourceAlert:
+		fields["resource"], fields["container"] = kind, target
+	case systemAlert:
+		fields["resource"] = kind
+		switch kind {
+		case "disk":
+			fields["mountpoint"] = target
+		case "dir":
+			fields["path"] = target
+		}
+	}
+	return fields
+}
+
+// Summary is the sentence introducing the items of the notification in the email templates
+func (n notification) Summary() string {
+	resolved := n.State == alertResolved
+	switch n.Type {
+	case containerAlert:
+		if resolved {
+			return fmt.Sprintf("The following containers on the server at '%s' are running again.", n.APMServerIP)
+		}
+		return fmt.Sprintf("The following containers are not running. Please logon to the server at '%s' and check.", n.APMServerIP)
+	case healthAlert:
+		if resolved {
+			return fmt.Sprintf("The following containers on the server at '%s' are healthy again.", n.APMServerIP)
+		}
+		return fmt.Sprintf("The following containers are running, but their health checks are failing. Please logon to the server at '%s' and check.", n.APMServerIP)
+	case restartAlert:
+		if resolved {
+			return fmt.Sprintf("The following containers on the server at '%s' stopped restarting.", n.APMServerIP)
+		}
+		return fmt.Sprintf("The following containers are restarting repeatedly. Please logon to the server at '%s' and check.", n.APMServerIP)
+	case daemonAlert:
+		if resolved {
+			return fmt.Sprintf("Admon can reach the Docker daemon on the server at '%s' again and resumed checking the containers.", n.APMServerIP)
+		}
+		return fmt.Sprintf("Admon cannot reach the Docker daemon, so the state of the containers is unknown. Please logon to the server at '%s' and check.", n.APMServerIP)
+	case containerResourceAlert:
+		if resolved {
+			return fmt.Sprintf("The following container resources on the server at '%s' are back below the threshold value.", n.APMServerIP)
+		}
+		return fmt.Sprintf("The following container resources on the server reached the threshold value. Please logon to the server at '%s' and check.", n.APMServerIP)
+	case systemAlert:
+		if resolved {
+			return fmt.Sprintf("The following system resources on the server at '%s' are back below the threshold value.", n.APMServerIP)
+		}
+		return fmt.Sprintf("The following system resources on the server reached the threshold value. Please logon to the server at '%s' and check.", n.APMServerIP)
+	default:
+		return fmt.Sprintf("Something went wrong with the Acceldata Admon tool at the server '%s'. Please logon to the server and check.", n.APMServerIP)
+	}
+}
+
+// postJSON posts the payload as JSON and fails on any non 2xx response
+func postJSON(client *http.Client, url string, payload interface{}, headers map[string]string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		logError("Cannot marshal the notification payload")
+		return err
+	}
+	return postBody(client, url, body, headers)
+}
+
+// postBody posts the raw body, as JSON unless the headers say otherwise, and fails on any non 2xx response
+func postBody(client *http.Client, url string, body []byte, headers map[string]string) error {
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		responseBody, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("'%s' responded with '%s': %s", request.URL.Host, response.Status, strings.TrimSpace(string(responseBody)))
+	}
+	return nil
+}
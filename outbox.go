@@ -0,0 +1,350 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	outboxDirName = "outbox"
+	// outboxPollInterval is how often the outbox is checked for the notifications due for a retry
+	outboxPollInterval    = 30 * time.Second
+	defaultRetryBackoff   = 60
+	defaultMaxBackoff     = 3600
+	defaultOutboxDuration = 86400
+)
+
+// outboxEntry is a notification which could not be delivered through one channel
+type outboxEntry struct {
+	ID           string       `json:"id"`
+	Channel      string       `json:"channel"`
+	Notification notification `json:"notification"`
+	Attempts     int          `json:"attempts"`
+	QueuedAt     time.Time    `json:"queuedAt"`
+	NextAttempt  time.Time    `json:"nextAttempt"`
+	LastError    string       `json:"lastError"`
+}
+
+// outbox keeps the undelivered notifications on disk, one file per notification & channel,
+// so they are retried until delivered or expired, even across restarts
+type outbox struct {
+	dir        string
+	backoff    time.Duration
+	maxBackoff time.Duration
+	expiry     time.Duration
+
+	mu sync.Mutex
+	// queued counts the entries of every channel, so the dispatch does not read the outbox to find the pending ones
+	queued map[string]int
+	// sending marks the channels being delivered, so an entry is never sent twice by the retries & the probes
+	sending map[string]bool
+}
+
+func newOutbox(dir string, config outboxConfig) (*outbox, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	backoff, maxBackoff, expiry := config.RetryBackoff, config.MaxBackoff, config.Expiry
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+	if maxBackoff < backoff {
+		maxBackoff = defaultMaxBackoff
+		if maxBackoff < backoff {
+			maxBackoff = backoff
+		}
+	}
+	if expiry <= 0 {
+		expiry = defaultOutboxDuration
+	}
+
+	entries, err := readOutbox(dir)
+	if err != nil {
+		return nil, err
+	}
+	queued := map[string]int{}
+	for _, entry := range entries {
+		queued[entry.Channel]++
+	}
+
+	return &outbox{
+		dir:        dir,
+		backoff:    time.Duration(backoff) * time.Second,
+		maxBackoff: time.Duration(maxBackoff) * time.Second,
+		expiry:     time.Duration(expiry) * time.Second,
+		queued:     queued,
+		sending:    map[string]bool{},
+	}, nil
+}
+
+// enqueue stores the notification for a later delivery attempt through the channel.
+// Without an error, the notification was not attempted yet and is due right away.
+func (o *outbox) enqueue(channel string, n notification, lastErr error) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	entry := outboxEntry{
+		ID:           fmt.Sprintf("%d-%s-%s", now.UnixNano(), channel, n.Type),
+		Channel:      channel,
+		Notification: n,
+		QueuedAt:     now,
+		NextAttempt:  now,
+	}
+	if lastErr != nil {
+		entry.Attempts = 1
+		entry.NextAttempt = now.Add(o.backoff)
+		entry.LastError = lastErr.Error()
+	}
+	if err := o.write(entry); err != nil {
+		return err
+	}
+	o.queued[channel]++
+	return nil
+}
+
+// pending tells whether the channel has undelivered notifications,
+// in which case the new ones are queued behind them to keep their order
+func (o *outbox) pending(channel string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.queued[channel] > 0
+}
+
+// retry attempts the due notifications of every channel, oldest first.
+// The notifications of the channels not configured anymore are dropped.
+func (o *outbox) retry(notifiers []notifier, history *alertHistory) {
+	entries, err := o.entries()
+	if err != nil {
+		logError("Cannot read the outbox. Because:", err.Error())
+		return
+	}
+
+	channels := map[string]notifier{}
+	for _, channel := range notifiers {
+		channels[channel.name()] = channel
+	}
+
+	byChannel := map[string][]outboxEntry{}
+	for _, entry := range entries {
+		if _, ok := channels[entry.Channel]; !ok {
+			logInfof("Dropping the queued %s alert '%s', the '%s' channel is not configured anymore", entry.Notification.Type, entry.ID, entry.Channel)
+			o.remove(entry)
+			continue
+		}
+		byChannel[entry.Channel] = append(byChannel[entry.Channel], entry)
+	}
+
+	for name, queued := range byChannel {
+		o.deliver(channels[name], queued, history, false)
+	}
+}
+
+// probe attempts the queued notifications of the channel right away, without waiting for their backoff.
+// A new alert probes its channel, so the channel which recovered does not hold it back until the next retry.
+func (o *outbox) probe(channel notifier, history *alertHistory) {
+	entries, err := o.entries()
+	if err != nil {
+		logError("Cannot read the outbox. Because:", err.Error())
+		return
+	}
+
+	queued := []outboxEntry{}
+	for _, entry := range entries {
+		if entry.Channel == channel.name() {
+			queued = append(queued, entry)
+		}
+	}
+	o.deliver(channel, queued, history, true)
+}
+
+// deliver sends the queued notifications of a channel in order. It stops at the first one which fails,
+// or which is not due yet unless probing, so the notifications of a channel are always delivered in order.
+// The lock is not held while sending, so the dispatch never waits on a slow channel to check for the pending notifications.
+// The failed, given up and delivered notifications are recorded in the history.
+func (o *outbox) deliver(channel notifier, entries []outboxEntry, history *alertHistory, probe bool) {
+	o.mu.Lock()
+	if o.sending[channel.name()] {
+		o.mu.Unlock()
+		return
+	}
+	o.sending[channel.name()] = true
+	o.mu.Unlock()
+
+	defer func() {
+		o.mu.Lock()
+		delete(o.sending, channel.name())
+		o.mu.Unlock()
+	}()
+
+	now := time.Now()
+	for _, entry := range entries {
+		if now.Sub(entry.QueuedAt) > o.expiry {
+			logErrorf("Giving up the %s alert '%s' via '%s' after %d attempts. Last error: %s", entry.Notification.Type, entry.ID, entry.Channel, entry.Attempts, entry.LastError)
+			history.record(historyDeliveryFailed, entry.Notification, entry.Channel, fmt.Errorf("gave up after %d attempts: %s", entry.Attempts, entry.LastError))
+			o.remove(entry)
+			continue
+		}
+		if !probe && now.Before(entry.NextAttempt) {
+			return
+		}
+
+		if err := channel.notify(entry.Notification); err != nil {
+			entry.Attempts++
+			entry.LastError = err.Error()
+			entry.NextAttempt = time.Now().Add(o.nextBackoff(entry.Attempts))
+			logErrorf("Attempt %d of the queued %s alert '%s' via '%s' failed. Because: %s", entry.Attempts, entry.Notification.Type, entry.ID, entry.Channel, err.Error())
+			history.record(historyDeliveryFailed, entry.Notification, entry.Channel, err)
+			o.update(entry)
+			return
+		}
+
+		logInfof("Delivered the queued %s alert '%s' via '%s'", entry.Notification.Type, entry.ID, entry.Channel)
+		history.record(historyDelivered, entry.Notification, entry.Channel, nil)
+		o.remove(entry)
+	}
+}
+
+// nextBackoff doubles the wait after every failed attempt, up to the max backoff
+func (o *outbox) nextBackoff(attempts int) time.Duration {
+	backoff := o.backoff
+	for i := 1; i < attempts && backoff < o.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > o.maxBackoff {
+		backoff = o.maxBackoff
+	}
+	return backoff
+}
+
+// entries reads the queued entries, oldest first
+func (o *outbox) entries() ([]outboxEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return readOutbox(o.dir)
+}
+
+// update stores the entry after a failed attempt
+func (o *outbox) update(entry outboxEntry) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if err := o.write(entry); err != nil {
+		logError("Cannot update the outbox. Because:", err.Error())
+	}
+}
+
+// write replaces the entry file atomically, so a crash never leaves a partial entry behind
+func (o *outbox) write(entry outboxEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(o.dir, entry.ID+".json"), data)
+}
+
+func (o *outbox) remove(entry outboxEntry) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if err := os.Remove(filepath.Join(o.dir, entry.ID+".json")); err != nil && !os.IsNotExist(err) {
+		logError("Cannot remove the entry from the outbox. Because:", err.Error())
+		return
+	}
+	if o.queued[entry.Channel] > 0 {
+		o.queued[entry.Channel]--
+	}
+}
+
+// readOutbox returns the queued entries, oldest first
+func readOutbox(dir string) ([]outboxEntry, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	entries := []outboxEntry{}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		entry := outboxEntry{}
+		if err := json.Unmarshal(data, &entry); err != nil {
+			logErrorf("Skipping the corrupted outbox entry '%s'. Because: %s", file.Name(), err.Error())
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].QueuedAt.Before(entries[j].QueuedAt)
+	})
+	return entries, nil
+}
+
+// printOutbox lists the queued notifications for the 'outbox' command
+func printOutbox(dir string) error {
+	entries, err := readOutbox(dir)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		logInfo("The outbox is empty")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCHANNEL\tTYPE\tSTATE\tITEMS\tATTEMPTS\tQUEUED\tNEXT ATTEMPT\tLAST ERROR")
+	for _, entry := range entries {
+		n := entry.Notification
+		items := strings.Join(n.Keys, ",")
+		if items == "" {
+			items = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			entry.ID,
+			entry.Channel,
+			n.Type,
+			n.State,
+			items,
+			entry.Attempts,
+			entry.QueuedAt.Format(time.RFC3339),
+			entry.NextAttempt.Format(time.RFC3339),
+			entry.LastError,
+		)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,221 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeNotifier fails the given number of times, then records the keys of the notifications it sends
+type fakeNotifier struct {
+	channel  string
+	failures int
+	sent     []string
+}
+
+func (f *fakeNotifier) name() string {
+	return f.channel
+}
+
+func (f *fakeNotifier) notify(n notification) error {
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("relay down")
+	}
+	f.sent = append(f.sent, n.Keys...)
+	return nil
+}
+
+// queuedEntry is an email entry of the item, queued 'age' ago and due in 'due'
+func queuedEntry(item string, age, due time.Duration) outboxEntry {
+	now := time.Now()
+	return outboxEntry{
+		ID:           item,
+		Channel:      "email",
+		Notification: notification{Type: containerAlert, Keys: []string{item}},
+		QueuedAt:     now.Add(-age),
+		NextAttempt:  now.Add(due),
+	}
+}
+
+// newTestOutbox creates an outbox holding the entries, retried after 60s up to 1h and expiring after 1 day
+func newTestOutbox(t *testing.T, entries []outboxEntry) *outbox {
+	o, err := newOutbox(t.TempDir(), outboxConfig{RetryBackoff: 60, MaxBackoff: 3600, Expiry: 86400})
+	if err != nil {
+		t.Fatalf("newOutbox() returned the error: %s", err)
+	}
+	for _, entry := range entries {
+		if err := o.write(entry); err != nil {
+			t.Fatalf("cannot write the outbox entry: %s", err)
+		}
+		o.queued[entry.Channel]++
+	}
+	return o
+}
+
+// outboxKeys lists the keys of the entries left in the outbox, oldest first
+func outboxKeys(t *testing.T, o *outbox) []string {
+	entries, err := readOutbox(o.dir)
+	if err != nil {
+		t.Fatalf("readOutbox() returned the error: %s", err)
+	}
+	keys := []string{}
+	for _, entry := range entries {
+		keys = append(keys, entry.Notification.Keys...)
+	}
+	return keys
+}
+
+func TestNextBackoff(t *testing.T) {
+	o := &outbox{backoff: time.Minute, maxBackoff: time.Hour}
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{6, 32 * time.Minute},
+		{7, time.Hour},
+		{50, time.Hour},
+	}
+
+	for _, test := range tests {
+		if got := o.nextBackoff(test.attempts); got != test.want {
+			t.Errorf("nextBackoff(%d) = %s, want %s", test.attempts, got, test.want)
+		}
+	}
+}
+
+func TestOutboxRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  []outboxEntry
+		channel  string
+		failures int
+		probe    bool
+		wantSent []string
+		wantLeft []string
+	}{
+		{
+			name:     "due entries are delivered oldest first",
+			entries:  []outboxEntry{queuedEntry("b", time.Minute, 0), queuedEntry("a", time.Hour, 0), queuedEntry("c", time.Second, 0)},
+			wantSent: []string{"a", "b", "c"},
+			wantLeft: []string{},
+		},
+		{
+			name:     "a failure holds back the next entries",
+			entries:  []outboxEntry{queuedEntry("a", time.Hour, 0), queuedEntry("b", time.Minute, 0)},
+			failures: 1,
+			wantSent: nil,
+			wantLeft: []string{"a", "b"},
+		},
+		{
+			name:     "an entry not due holds back the next entries",
+			entries:  []outboxEntry{queuedEntry("a", time.Hour, time.Hour), queuedEntry("b", time.Minute, 0)},
+			wantSent: nil,
+			wantLeft: []string{"a", "b"},
+		},
+		{
+			name:     "a probe does not wait for the backoff",
+			entries:  []outboxEntry{queuedEntry("a", time.Hour, time.Hour), queuedEntry("b", time.Minute, 0)},
+			probe:    true,
+			wantSent: []string{"a", "b"},
+			wantLeft: []string{},
+		},
+		{
+			name:     "a failed probe keeps the entries",
+			entries:  []outboxEntry{queuedEntry("a", time.Hour, time.Hour), queuedEntry("b", time.Minute, 0)},
+			failures: 1,
+			probe:    true,
+			wantSent: nil,
+			wantLeft: []string{"a", "b"},
+		},
+		{
+			name:     "expired entries are given up",
+			entries:  []outboxEntry{queuedEntry("a", 48*time.Hour, time.Hour), queuedEntry("b", time.Minute, 0)},
+			wantSent: []string{"b"},
+			wantLeft: []string{},
+		},
+		{
+			name:     "entries of a channel not configured anymore are dropped",
+			entries:  []outboxEntry{queuedEntry("a", time.Hour, 0)},
+			channel:  "slack",
+			wantSent: nil,
+			wantLeft: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			o := newTestOutbox(t, test.entries)
+			channel := &fakeNotifier{channel: test.channel, failures: test.failures}
+			if channel.channel == "" {
+				channel.channel = "email"
+			}
+
+			if test.probe {
+				o.probe(channel, nil)
+			} else {
+				o.retry([]notifier{channel}, nil)
+			}
+
+			if !reflect.DeepEqual(channel.sent, test.wantSent) {
+				t.Errorf("sent %v, want %v", channel.sent, test.wantSent)
+			}
+			if left := outboxKeys(t, o); !reflect.DeepEqual(left, test.wantLeft) {
+				t.Errorf("left %v in the outbox, want %v", left, test.wantLeft)
+			}
+			if got, want := o.pending("email"), len(test.wantLeft) > 0; got != want {
+				t.Errorf("pending() = %t, want %t", got, want)
+			}
+		})
+	}
+}
+
+func TestSendBehindQueued(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		wantErr  bool
+		wantSent []string
+		wantLeft []string
+	}{
+		{"recovered channel delivers the queued alerts first", 0, false, []string{"a", "new"}, []string{}},
+		{"failing channel queues the new alert behind", 1, true, nil, []string{"a", "new"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := &dispatcher{outbox: newTestOutbox(t, []outboxEntry{queuedEntry("a", time.Hour, time.Hour)})}
+			channel := &fakeNotifier{channel: "email", failures: test.failures}
+
+			err := d.send(channel, notification{Type: containerAlert, Keys: []string{"new"}})
+			if (err != nil) != test.wantErr {
+				t.Errorf("send() error = %v, want an error %t", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(channel.sent, test.wantSent) {
+				t.Errorf("sent %v, want %v", channel.sent, test.wantSent)
+			}
+			if left := outboxKeys(t, d.outbox); !reflect.DeepEqual(left, test.wantLeft) {
+				t.Errorf("left %v in the outbox, want %v", left, test.wantLeft)
+			}
+		})
+	}
+}
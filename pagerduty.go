@@ -0,0 +1,122 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+	// PagerDuty truncates the summaries longer than 1024 characters
+	pagerDutyMaxSummaryLength = 1024
+)
+
+type pagerDutyNotifier struct {
+	routingKey string
+	eventsURL  string
+	client     *http.Client
+}
+
+// PagerDuty Events API v2 payload
+// See: https://developer.pagerduty.com/docs/events-api-v2/trigger-events/
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Component     string            `json:"component,omitempty"`
+	Group         string            `json:"group,omitempty"`
+	Class         string            `json:"class,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+func newPagerDutyNotifier(config adMonConfig) (notifier, error) {
+	if strings.TrimSpace(config.PagerDuty.RoutingKey) == "" {
+		return nil, errors.New("the 'pagerDuty.routingKey' property is empty")
+	}
+
+	eventsURL := config.PagerDuty.EventsURL
+	if eventsURL == "" {
+		eventsURL = pagerDutyEventsURL
+	}
+
+	return &pagerDutyNotifier{
+		routingKey: config.PagerDuty.RoutingKey,
+		eventsURL:  eventsURL,
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (p *pagerDutyNotifier) name() string {
+	return "pagerduty"
+}
+
+// notify sends an event per item, so every container / resource is a separate incident
+// which is resolved on its own when the condition clears
+func (p *pagerDutyNotifier) notify(n notification) error {
+	for _, event := range buildPagerDutyEvents(p.routingKey, n) {
+		if err := postJSON(p.client, p.eventsURL, event, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildPagerDutyEvents returns the events of the notification. The admon errors are not sent, as they are never resolved.
+func buildPagerDutyEvents(routingKey string, n notification) []pagerDutyEvent {
+	events := []pagerDutyEvent{}
+	if n.Type == errorAlert {
+		return events
+	}
+
+	for i, key := range n.Keys {
+		event := pagerDutyEvent{
+			RoutingKey:  routingKey,
+			EventAction: "trigger",
+			// Stable per host & item, so the repeated alerts are grouped into the same incident
+			DedupKey: "admon/" + n.Host + "/" + string(n.Type) + "/" + key,
+		}
+
+		if n.State == alertResolved {
+			event.EventAction = "resolve"
+		} else {
+			event.Payload = &pagerDutyPayload{
+				Summary:   truncateText(n.title()+": "+strings.TrimSpace(n.Items[i]), pagerDutyMaxSummaryLength),
+				Source:    n.Host,
+				Severity:  n.severity(),
+				Component: key,
+				Group:     n.APMServerIP,
+				Class:     string(n.Type),
+				CustomDetails: map[string]string{
+					"host":        n.Host,
+					"apmServerIP": n.APMServerIP,
+					"alert":       n.title(),
+				},
+			}
+		}
+		events = append(events, event)
+	}
+	return events
+}
@@ -0,0 +1,103 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestBuildPagerDutyEvents(t *testing.T) {
+	tests := []struct {
+		name        string
+		n           notification
+		wantActions []string
+		wantKeys    []string
+	}{
+		{
+			name:        "an event per item",
+			n:           notification{Type: containerAlert, Host: "node1", Keys: []string{"api", "web"}, Items: []string{"api [new]", "web [new]"}},
+			wantActions: []string{"trigger", "trigger"},
+			wantKeys:    []string{"admon/node1/container/api", "admon/node1/container/web"},
+		},
+		{
+			name:        "reminder about one of the items",
+			n:           notification{Type: containerAlert, Host: "node1", Keys: []string{"web"}, Items: []string{"web [still down for 10m0s]"}},
+			wantActions: []string{"trigger"},
+			wantKeys:    []string{"admon/node1/container/web"},
+		},
+		{
+			name:        "resolved items",
+			n:           notification{Type: containerAlert, State: alertResolved, Host: "node1", Keys: []string{"web"}, Items: []string{"web - was down for 20m0s"}},
+			wantActions: []string{"resolve"},
+			wantKeys:    []string{"admon/node1/container/web"},
+		},
+		{
+			name:        "other alert type",
+			n:           notification{Type: healthAlert, Host: "node1", Keys: []string{"web"}, Items: []string{"web is unhealthy"}},
+			wantActions: []string{"trigger"},
+			wantKeys:    []string{"admon/node1/health/web"},
+		},
+		{
+			name:        "other host",
+			n:           notification{Type: systemAlert, Host: "node2", Keys: []string{"disk:/"}, Items: []string{"Disk usage of '/' is 95%"}},
+			wantActions: []string{"trigger"},
+			wantKeys:    []string{"admon/node2/system/disk:/"},
+		},
+		{
+			name: "admon errors are never sent",
+			n:    notification{Type: errorAlert, Host: "node1", ErrorMessage: "Cannot write to the state file"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actions, keys := []string{}, []string{}
+			for _, event := range buildPagerDutyEvents("routing-key", test.n) {
+				actions = append(actions, event.EventAction)
+				keys = append(keys, event.DedupKey)
+				if event.RoutingKey != "routing-key" {
+					t.Errorf("routing key = %s, want routing-key", event.RoutingKey)
+				}
+				if (event.Payload == nil) != (event.EventAction == "resolve") {
+					t.Errorf("the '%s' event of %s has the payload %+v", event.EventAction, event.DedupKey, event.Payload)
+				}
+			}
+			if len(test.wantActions) == 0 {
+				test.wantActions, test.wantKeys = []string{}, []string{}
+			}
+			if !reflect.DeepEqual(actions, test.wantActions) {
+				t.Errorf("event actions = %v, want %v", actions, test.wantActions)
+			}
+			if !reflect.DeepEqual(keys, test.wantKeys) {
+				t.Errorf("dedup keys = %v, want %v", keys, test.wantKeys)
+			}
+		})
+	}
+}
+
+func TestPagerDutySummaryLength(t *testing.T) {
+	n := notification{Type: containerAlert, Host: "node1", Keys: []string{"web"}, Items: []string{strings.Repeat("é", 2000)}}
+
+	summary := buildPagerDutyEvents("routing-key", n)[0].Payload.Summary
+	if length := utf8.RuneCountInString(summary); length != pagerDutyMaxSummaryLength {
+		t.Errorf("summary length = %d characters, want %d", length, pagerDutyMaxSummaryLength)
+	}
+	if !utf8.ValidString(summary) {
+		t.Error("the truncated summary is not valid UTF-8")
+	}
+}
@@ -0,0 +1,220 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// restartRecord is a single observed restart of a container
+type restartRecord struct {
+	at        time.Time
+	exitCode  int
+	exitKnown bool
+	oomKilled bool
+}
+
+// restartHistory is what the restartTracker knows about a single container
+type restartHistory struct {
+	restartCount int
+	startedAt    string
+	exitCode     int
+	exitKnown    bool
+	oomKilled    bool
+	restarts     []restartRecord
+}
+
+// restartTracker detects the containers restarting more than 'maxRestarts' times within the 'window'
+type restartTracker struct {
+	maxRestarts int
+	window      time.Duration
+	containers  map[string]*restartHistory
+}
+
+func newRestartTracker(config restartConfig) *restartTracker {
+	return &restartTracker{
+		maxRestarts: config.MaxRestarts,
+		window:      time.Duration(config.Window) * time.Second,
+		containers:  map[string]*restartHistory{},
+	}
+}
+
+// observe records the current state of a container, counting the restarts happened since the previous observation
+func (t *restartTracker) observe(containerName string, details types.ContainerJSON, now time.Time) {
+	if details.ContainerJSONBase == nil || details.State == nil {
+		return
+	}
+	state := details.State
+
+	history, ok := t.containers[containerName]
+	if !ok {
+		// First sight of the container, nothing to compare with
+		t.containers[containerName] = &restartHistory{
+			restartCount: details.RestartCount,
+			startedAt:    state.StartedAt,
+			exitCode:     state.ExitCode,
+			exitKnown:    !state.Running,
+		}
+		return
+	}
+
+	// The restart policy increments the RestartCount, the manual restarts change only the StartedAt
+	restarts := details.RestartCount - history.restartCount
+	if restarts < 0 {
+		// The container was re-created
+		restarts = 0
+	}
+	if restarts == 0 && state.StartedAt != history.startedAt {
+		restarts = 1
+	}
+
+	for i := 0; i < restarts; i++ {
+		history.restarts = append(history.restarts, restartRecord{
+			at:        now,
+			exitCode:  history.exitCode,
+			exitKnown: history.exitKnown && i == restarts-1,
+			oomKilled: state.OOMKilled || history.oomKilled,
+		})
+	}
+	if restarts > 0 {
+		history.oomKilled = false
+	}
+
+	history.restartCount = details.RestartCount
+	history.startedAt = state.StartedAt
+	if !state.Running {
+		// Docker resets the exit code once the container is running again
+		history.exitCode, history.exitKnown = state.ExitCode, true
+	} else if restarts > 0 {
+		history.exitKnown = false
+	}
+	history.prune(t.window, now)
+}
+
+// prune forgets the restarts outside of the window
+func (h *restartHistory) prune(window time.Duration, now time.Time) {
+	recent := []restartRecord{}
+	for _, record := range h.restarts {
+		if now.Sub(record.at) <= window {
+			recent = append(recent, record)
+		}
+	}
+	h.restarts = recent
+}
+
+// tracked returns the names of the containers observed so far
+func (t *restartTracker) tracked() []string {
+	containers := []string{}
+	for containerName := range t.containers {
+		containers = append(containers, containerName)
+	}
+	sort.Strings(containers)
+	return containers
+}
+
+// recentRestarts returns the number of restarts of the container within the window, at most the window of the tracker
+func (t *restartTracker) recentRestarts(containerName string, window time.Duration, now time.Time) int {
+	history, ok := t.containers[containerName]
+	if !ok {
+		return 0
+	}
+	history.prune(t.window, now)
+
+	recent := 0
+	for _, record := range history.restarts {
+		if now.Sub(record.at) <= window {
+			recent++
+		}
+	}
+	return recent
+}
+
+// forget drops the containers which no longer exist, i.e. missing from the inspected ones
+func (t *restartTracker) forget(inspected map[string]types.ContainerJSON) {
+	for containerName := range t.containers {
+		if _, ok := inspected[containerName]; !ok {
+			delete(t.containers, containerName)
+		}
+	}
+}
+
+// recordExit keeps the exit code reported by the docker events, for the next restart of the container
+func (t *restartTracker) recordExit(containerName string, exitCode int) {
+	if history, ok := t.containers[containerName]; ok {
+		history.exitCode, history.exitKnown = exitCode, true
+	}
+}
+
+// recordOOM marks the next restart of the container as caused by the OOM killer
+func (t *restartTracker) recordOOM(containerName string) {
+	if history, ok := t.containers[containerName]; ok {
+		history.oomKilled = true
+	}
+}
+
+// flapping returns the containers which restarted more than the allowed times within the window, mapped to their alert messages.
+// The containers which stopped, so are not observed anymore, stop flapping once their restarts are out of the window.
+func (t *restartTracker) flapping(now time.Time) map[string]string {
+	flapping := map[string]string{}
+
+	for containerName, history := range t.containers {
+		history.prune(t.window, now)
+		if len(history.restarts) <= t.maxRestarts {
+			continue
+		}
+
+		exitCodes := []string{}
+		oomKilled := false
+		for _, record := range history.restarts {
+			if record.exitKnown {
+				exitCodes = append(exitCodes, strconv.Itoa(record.exitCode))
+			} else {
+				exitCodes = append(exitCodes, "unknown")
+			}
+			oomKilled = oomKilled || record.oomKilled
+		}
+
+		flapping[containerName] = fmt.Sprintf("%s - restarted %d times in the last %s. Exit codes: %s. OOMKilled: %t", containerName, len(history.restarts), t.window, strings.Join(exitCodes, ", "), oomKilled)
+	}
+
+	return flapping
+}
+
+// inspectContainers returns the docker inspect details of the given containers. The containers which don't exist are skipped.
+func inspectContainers(cli *client.Client, containers []string) (map[string]types.ContainerJSON, error) {
+	result := map[string]types.ContainerJSON{}
+	ctx := context.Background()
+
+	for _, containerName := range containers {
+		details, err := cli.ContainerInspect(ctx, containerName)
+		if client.IsErrNotFound(err) {
+			continue
+		} else if err != nil {
+			logErrorf("Cannot inspect the container '%s'", containerName)
+			return result, err
+		}
+		result[containerName] = details
+	}
+
+	return result, nil
+}
@@ -0,0 +1,201 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+var severities = []string{"critical", "error", "warning"}
+
+// validateRoutes checks the match criteria and the channels of the routing rules
+func validateRoutes(routes []routeConfig) error {
+	for i, route := range routes {
+		name := route.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+
+		if err := validateMatch(route.Match, fmt.Sprintf("the route '%s'", name)); err != nil {
+			return err
+		}
+		for _, channel := range route.Channels {
+			if _, ok := notifierRegistry[channel]; !ok {
+				return fmt.Errorf("unknown notification channel '%s' in the route '%s'. Supported channels: %s", channel, name, strings.Join(registeredChannels(), ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// validateMatch checks the alert types, the severities and the patterns of the match criteria of a route, silence ...
+func validateMatch(match routeMatch, where string) error {
+	for _, alert := range match.Types {
+		if !containsString(alertTypeNames(), alert) {
+			return fmt.Errorf("unknown alert type '%s' in %s. Supported types: %s", alert, where, strings.Join(alertTypeNames(), ", "))
+		}
+	}
+	for _, severity := range match.Severities {
+		if !containsString(severities, severity) {
+			return fmt.Errorf("unknown severity '%s' in %s. Supported severities: %s", severity, where, strings.Join(severities, ", "))
+		}
+	}
+	for _, pattern := range append(append([]string{}, match.Containers...), match.Mountpoints...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern '%s' in %s: %s", pattern, where, err.Error())
+		}
+	}
+	return nil
+}
+
+// matches tells whether the item of the notification satisfies all the criteria, the criteria left out matching everything.
+// The key is empty for the notifications without items, e.g. the admon errors.
+func (m routeMatch) matches(n notification, key string) bool {
+	if len(m.Types) > 0 && !containsString(m.Types, string(n.Type)) {
+		return false
+	}
+	if len(m.Severities) > 0 && !containsString(m.Severities, n.severity()) {
+		return false
+	}
+
+	fields := itemFields(n, key)
+	if len(m.Containers) > 0 && !matchesAnyPattern(m.Containers, fields["container"]) {
+		return false
+	}
+	if len(m.Mountpoints) > 0 && !matchesAnyPattern(m.Mountpoints, fields["mountpoint"]) {
+		return false
+	}
+	return true
+}
+
+func matchesAnyPattern(patterns []string, value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// delivery is a part of a notification going to some of the channels
+type delivery struct {
+	n        notification
+	channels []string
+}
+
+// route splits the notification by the routes its items match. The routes are evaluated in order and the first
+// matching one is used, unless it sets 'continue'. The items matching no route go to the default channels.
+// The snoozed items are listed in the parts of their routes, but never make a part on their own.
+func route(n notification, routes []routeConfig, defaultChannels []string) []delivery {
+	if len(routes) == 0 {
+		return []delivery{{n: n, channels: defaultChannels}}
+	}
+
+	keys := n.Keys
+	if len(keys) == 0 {
+		keys = []string{""}
+	}
+
+	// The indexes of the items going to each route, -1 being the default channels
+	routed := map[int][]int{}
+	order := []int{}
+	for i, key := range keys {
+		for _, r := range matchingRoutes(n, key, routes) {
+			if _, ok := routed[r]; !ok {
+				order = append(order, r)
+			}
+			routed[r] = append(routed[r], i)
+		}
+	}
+
+	snoozed := map[int][]int{}
+	for i, key := range n.SnoozedKeys {
+		for _, r := range matchingRoutes(n, key, routes) {
+			snoozed[r] = append(snoozed[r], i)
+		}
+	}
+
+	deliveries := []delivery{}
+	for _, r := range order {
+		part := n
+		if len(n.Keys) > 0 {
+			part = n.subset(routed[r])
+		}
+		part.Snoozed, part.SnoozedKeys = nil, nil
+		for _, i := range snoozed[r] {
+			part.Snoozed, part.SnoozedKeys = append(part.Snoozed, n.Snoozed[i]), append(part.SnoozedKeys, n.SnoozedKeys[i])
+		}
+
+		channels := defaultChannels
+		if r >= 0 {
+			if len(routes[r].Channels) > 0 {
+				channels = routes[r].Channels
+			}
+			part.Receivers = routes[r].Receivers
+		}
+		deliveries = append(deliveries, delivery{n: part, channels: channels})
+	}
+	return deliveries
+}
+
+// matchingRoutes returns the indexes of the routes of the item, or -1 for the default channels
+func matchingRoutes(n notification, key string, routes []routeConfig) []int {
+	matched := []int{}
+	for r, route := range routes {
+		if !route.Match.matches(n, key) {
+			continue
+		}
+		matched = append(matched, r)
+		if !route.Continue {
+			break
+		}
+	}
+	if len(matched) == 0 {
+		matched = append(matched, -1)
+	}
+	return matched
+}
+
+// subset returns the notification with only the items at the given indexes
+func (n notification) subset(indexes []int) notification {
+	part := n
+	part.Items, part.Keys, part.Values, part.FirstSeen = nil, nil, nil, nil
+	for _, i := range indexes {
+		part.Keys = append(part.Keys, n.Keys[i])
+		if i < len(n.Items) {
+			part.Items = append(part.Items, n.Items[i])
+		}
+		if i < len(n.Values) {
+			part.Values = append(part.Values, n.Values[i])
+		}
+		if i < len(n.FirstSeen) {
+			part.FirstSeen = append(part.FirstSeen, n.FirstSeen[i])
+		}
+	}
+	return part
+}
+
+func alertTypeNames() []string {
+	names := []string{}
+	for _, alert := range alertTypes {
+		names = append(names, string(alert))
+	}
+	return names
+}
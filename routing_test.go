@@ -0,0 +1,128 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRoute(t *testing.T) {
+	routes := []routeConfig{
+		{Match: routeMatch{Containers: []string{"ad-*"}}, Channels: []string{"slack"}, Continue: true},
+		{Match: routeMatch{Containers: []string{"ad-db"}}, Channels: []string{"pagerduty"}, Receivers: []string{"dba@example.com"}},
+		{Match: routeMatch{Types: []string{"system"}}, Channels: []string{"teams"}},
+	}
+
+	// part is the expected channels, keys & receivers of a delivery
+	type part struct {
+		channels  []string
+		keys      []string
+		receivers []string
+	}
+
+	tests := []struct {
+		name   string
+		n      notification
+		routes []routeConfig
+		want   []part
+	}{
+		{
+			name:   "no routes",
+			n:      notification{Type: containerAlert, Keys: []string{"ad-db", "web"}, Items: []string{"ad-db", "web"}},
+			routes: nil,
+			want:   []part{{channels: []string{"email"}, keys: []string{"ad-db", "web"}}},
+		},
+		{
+			name:   "continue to the next matching route",
+			n:      notification{Type: containerAlert, Keys: []string{"ad-db"}, Items: []string{"ad-db"}},
+			routes: routes,
+			want: []part{
+				{channels: []string{"slack"}, keys: []string{"ad-db"}},
+				{channels: []string{"pagerduty"}, keys: []string{"ad-db"}, receivers: []string{"dba@example.com"}},
+			},
+		},
+		{
+			name:   "continue without another matching route",
+			n:      notification{Type: containerAlert, Keys: []string{"ad-web"}, Items: []string{"ad-web"}},
+			routes: routes,
+			want:   []part{{channels: []string{"slack"}, keys: []string{"ad-web"}}},
+		},
+		{
+			name:   "unmatched items go to the default channels",
+			n:      notification{Type: containerAlert, Keys: []string{"web", "ad-web", "api"}, Items: []string{"web", "ad-web", "api"}},
+			routes: routes,
+			want: []part{
+				{channels: []string{"email"}, keys: []string{"web", "api"}},
+				{channels: []string{"slack"}, keys: []string{"ad-web"}},
+			},
+		},
+		{
+			name:   "first matching route only",
+			n:      notification{Type: systemAlert, Keys: []string{"cpu", "disk:/"}, Items: []string{"cpu", "disk:/"}},
+			routes: routes,
+			want:   []part{{channels: []string{"teams"}, keys: []string{"cpu", "disk:/"}}},
+		},
+		{
+			name:   "route without channels uses the default ones",
+			n:      notification{Type: healthAlert, Keys: []string{"web"}, Items: []string{"web"}},
+			routes: []routeConfig{{Match: routeMatch{Types: []string{"health"}}, Receivers: []string{"ops@example.com"}}},
+			want:   []part{{channels: []string{"email"}, keys: []string{"web"}, receivers: []string{"ops@example.com"}}},
+		},
+		{
+			name:   "notification without items",
+			n:      notification{Type: errorAlert, ErrorMessage: "Cannot write to the state file"},
+			routes: []routeConfig{{Match: routeMatch{Types: []string{"error"}}, Channels: []string{"slack"}}},
+			want:   []part{{channels: []string{"slack"}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := []part{}
+			for _, delivery := range route(test.n, test.routes, []string{"email"}) {
+				got = append(got, part{channels: delivery.channels, keys: delivery.n.Keys, receivers: delivery.n.Receivers})
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("route() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRouteSnoozed(t *testing.T) {
+	routes := []routeConfig{
+		{Match: routeMatch{Containers: []string{"ad-*"}}, Channels: []string{"slack"}},
+		{Match: routeMatch{Containers: []string{"db"}}, Channels: []string{"pagerduty"}},
+	}
+	n := notification{
+		Type:        containerAlert,
+		Keys:        []string{"ad-web", "web"},
+		Items:       []string{"ad-web [new]", "web [new]"},
+		Snoozed:     []string{"ad-api [still down for 5m0s]", "db [still down for 5m0s]", "api [still down for 5m0s]"},
+		SnoozedKeys: []string{"ad-api", "db", "api"},
+	}
+
+	got := map[string][]string{}
+	for _, delivery := range route(n, routes, []string{"email"}) {
+		got[delivery.channels[0]] = delivery.n.SnoozedKeys
+	}
+
+	// The snoozed items follow their routes, but 'db' alone makes no pagerduty delivery
+	want := map[string][]string{"slack": {"ad-api"}, "email": {"api"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("route() snoozed items = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,173 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+const (
+	composeProjectLabel = "com.docker.compose.project"
+	composeServiceLabel = "com.docker.compose.service"
+)
+
+// validateSelectors checks the container selectors and compiles their regular expressions
+func validateSelectors(selectors []containerSelector) error {
+	names := map[string]bool{}
+	for i := range selectors {
+		selector := &selectors[i]
+		if strings.TrimSpace(selector.Name) == "" {
+			return fmt.Errorf("the container selector #%d has no 'name'", i+1)
+		}
+		if names[selector.Name] {
+			return fmt.Errorf("the container selector name '%s' is used more than once", selector.Name)
+		}
+		names[selector.Name] = true
+
+		if selector.Pattern == "" && selector.Regex == "" && len(selector.Labels) == 0 && selector.ComposeProject == "" && selector.ComposeService == "" {
+			return errors.New("the container selector '" + selector.Name + "' needs at least one of 'pattern', 'regex', 'labels', 'composeProject' or 'composeService'")
+		}
+		if selector.Pattern != "" {
+			if _, err := path.Match(selector.Pattern, ""); err != nil {
+				return fmt.Errorf("invalid 'pattern' in the container selector '%s': %s", selector.Name, err.Error())
+			}
+		}
+		if selector.Regex != "" {
+			compiled, err := regexp.Compile(selector.Regex)
+			if err != nil {
+				return fmt.Errorf("invalid 'regex' in the container selector '%s': %s", selector.Name, err.Error())
+			}
+			selector.compiled = compiled
+		}
+		if selector.Replicas < 0 {
+			return fmt.Errorf("invalid 'replicas' in the container selector '%s': %d", selector.Name, selector.Replicas)
+		}
+	}
+	return nil
+}
+
+// matches reports whether a container satisfies all the criteria of the selector
+func (s containerSelector) matches(containerName string, labels map[string]string) bool {
+	if s.Pattern != "" {
+		if matched, _ := path.Match(s.Pattern, containerName); !matched {
+			return false
+		}
+	}
+	if s.compiled != nil && !s.compiled.MatchString(containerName) {
+		return false
+	}
+	for key, value := range s.Labels {
+		labelValue, ok := labels[key]
+		// An empty value only requires the label to be present
+		if !ok || (value != "" && labelValue != value) {
+			return false
+		}
+	}
+	if s.ComposeProject != "" && labels[composeProjectLabel] != s.ComposeProject {
+		return false
+	}
+	if s.ComposeService != "" && labels[composeServiceLabel] != s.ComposeService {
+		return false
+	}
+	return true
+}
+
+func (s containerSelector) expectedReplicas() int {
+	if s.Replicas == 0 {
+		return 1
+	}
+	return s.Replicas
+}
+
+// containerSelection is the result of matching the running containers against the configured names & selectors
+type containerSelection struct {
+	// missing maps the missing container names and the selectors short of replicas to their alert messages.
+	// The selectors are keyed by 'selector:<name>', so they never collide with the container names.
+	missing map[string]string
+	// monitored is the list of running containers covered by the configuration
+	monitored []string
+}
+
+// selectContainers matches the running containers against the exact container names and the selectors
+func selectContainers(containerNames []string, selectors []containerSelector, running []types.Container) containerSelection {
+	selection := containerSelection{missing: map[string]string{}}
+
+	runningNames := []string{}
+	for _, container := range running {
+		runningNames = append(runningNames, containerName(container))
+	}
+
+	for _, name := range containerNames {
+		if containsString(runningNames, name) {
+			selection.monitored = append(selection.monitored, name)
+		} else {
+			selection.missing[name] = name
+		}
+	}
+
+	for _, selector := range selectors {
+		matched := []string{}
+		for _, container := range running {
+			name := containerName(container)
+			if selector.matches(name, container.Labels) {
+				matched = append(matched, name)
+				if !containsString(selection.monitored, name) {
+					selection.monitored = append(selection.monitored, name)
+				}
+			}
+		}
+
+		if expected := selector.expectedReplicas(); len(matched) < expected {
+			sort.Strings(matched)
+			message := fmt.Sprintf("%s - %d of %d expected replicas running", selectorKey(selector.Name), len(matched), expected)
+			if len(matched) > 0 {
+				message += " (" + strings.Join(matched, ", ") + ")"
+			}
+			selection.missing[selectorKey(selector.Name)] = message
+		}
+	}
+
+	sort.Strings(selection.monitored)
+	return selection
+}
+
+// selectorKey is the key of the alerts about the replicas of a selector
+func selectorKey(name string) string {
+	return "selector:" + name
+}
+
+// isMonitored reports whether a container is covered by the configured names or selectors
+func isMonitored(configData adMonConfig, containerName string, labels map[string]string) bool {
+	if containsString(configData.Containers, containerName) {
+		return true
+	}
+	for _, selector := range configData.ContainerSelectors {
+		if selector.matches(containerName, labels) {
+			return true
+		}
+	}
+	return false
+}
+
+func containerName(container types.Container) string {
+	return strings.TrimPrefix(container.Names[0], "/")
+}
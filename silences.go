@@ -0,0 +1,210 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// silence mutes the alerts of the matching items between its start and end times, e.g. during an upgrade.
+// The silenced alerts are still recorded in the history.
+type silence struct {
+	ID        string     `json:"id"`
+	Match     routeMatch `json:"match"`
+	Start     time.Time  `json:"start"`
+	End       time.Time  `json:"end"`
+	Comment   string     `json:"comment,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+func (s silence) active(now time.Time) bool {
+	return !now.Before(s.Start) && now.Before(s.End)
+}
+
+// pruneSilences drops the silences which are over
+func pruneSilences(silences []silence, now time.Time) []silence {
+	pruned := []silence{}
+	for _, s := range silences {
+		if now.Before(s.End) {
+			pruned = append(pruned, s)
+		}
+	}
+	return pruned
+}
+
+// silencedItems returns the silenced items of the notification, mapped to the silence or the maintenance window
+// muting them. The key of the notifications without items, e.g. the admon errors, is empty.
+func silencedItems(store *stateStore, configData adMonConfig, n notification, now time.Time) map[string]string {
+	silenced := map[string]string{}
+
+	reasons, matches := []string{}, []routeMatch{}
+	for _, s := range store.silences() {
+		if s.active(now) {
+			reasons, matches = append(reasons, "silence "+s.ID), append(matches, s.Match)
+		}
+	}
+	for _, window := range configData.MaintenanceWindows {
+		if !window.activeSince(now).IsZero() {
+			reasons, matches = append(reasons, "maintenance window "+window.Name), append(matches, window.Match)
+		}
+	}
+	if len(matches) == 0 {
+		return silenced
+	}
+
+	keys := n.Keys
+	if len(keys) == 0 {
+		keys = []string{""}
+	}
+	for _, key := range keys {
+		for i, match := range matches {
+			if match.matches(n, key) {
+				silenced[key] = reasons[i]
+				break
+			}
+		}
+	}
+	return silenced
+}
+
+// newSilence builds a silence for the 'silence add' command. Without any criteria, 'all' must be set to silence everything.
+func newSilence(match routeMatch, all bool, start, end time.Time, comment string) (silence, error) {
+	if !all && len(match.Types) == 0 && len(match.Severities) == 0 && len(match.Containers) == 0 && len(match.Mountpoints) == 0 {
+		return silence{}, errors.New("pass a '--type', '--container' or '--mountpoint' to silence, or '--all' to silence all the alerts")
+	}
+	if all && (len(match.Types) > 0 || len(match.Severities) > 0 || len(match.Containers) > 0 || len(match.Mountpoints) > 0) {
+		return silence{}, errors.New("'--all' cannot be combined with '--type', '--container' or '--mountpoint'")
+	}
+	if err := validateMatch(match, "the silence"); err != nil {
+		return silence{}, err
+	}
+	if !end.After(start) || !end.After(time.Now()) {
+		return silence{}, fmt.Errorf("the silence ends at '%s', before it starts or in the past", end.Format(time.RFC3339))
+	}
+
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return silence{}, err
+	}
+	return silence{
+		ID:        hex.EncodeToString(id),
+		Match:     match,
+		Start:     start,
+		End:       end,
+		Comment:   comment,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// describeMatch summarises the match criteria for the 'silence list' command
+func describeMatch(match routeMatch) string {
+	criteria := []string{}
+	for _, criterion := range []struct {
+		name   string
+		values []string
+	}{
+		{"type", match.Types},
+		{"severity", match.Severities},
+		{"container", match.Containers},
+		{"mountpoint", match.Mountpoints},
+	} {
+		if len(criterion.values) > 0 {
+			criteria = append(criteria, criterion.name+"="+strings.Join(criterion.values, ","))
+		}
+	}
+	if len(criteria) == 0 {
+		return "all"
+	}
+	return strings.Join(criteria, " ")
+}
+
+// printSilences lists the silences and the maintenance windows for the 'silence list' command, as a table or as JSON
+func printSilences(silences []silence, windows []maintenanceWindow, output string) error {
+	if output != "table" && output != "json" {
+		return fmt.Errorf("unsupported output '%s'. Supported outputs: table, json", output)
+	}
+
+	now := time.Now()
+	if output == "json" {
+		type windowState struct {
+			Name        string     `json:"name"`
+			Schedule    string     `json:"schedule"`
+			Duration    int        `json:"duration"`
+			Match       routeMatch `json:"match"`
+			ActiveSince *time.Time `json:"activeSince,omitempty"`
+			NextStart   *time.Time `json:"nextStart,omitempty"`
+		}
+		states := []windowState{}
+		for _, window := range windows {
+			state := windowState{Name: window.Name, Schedule: window.Schedule, Duration: window.Duration, Match: window.Match}
+			if since := window.activeSince(now); !since.IsZero() {
+				state.ActiveSince = &since
+			}
+			if next := window.nextStart(now); !next.IsZero() {
+				state.NextStart = &next
+			}
+			states = append(states, state)
+		}
+
+		data, err := json.MarshalIndent(map[string]interface{}{"silences": silences, "maintenanceWindows": states}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	if len(silences) == 0 {
+		logInfo("No silence")
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tMATCH\tSTATE\tSTART\tEND\tCOMMENT")
+		for _, s := range silences {
+			state := "pending"
+			if s.active(now) {
+				state = "active"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", s.ID, describeMatch(s.Match), state, s.Start.Local().Format("2006-01-02 15:04"), s.End.Local().Format("2006-01-02 15:04"), s.Comment)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(windows) == 0 {
+		return nil
+	}
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MAINTENANCE WINDOW\tSCHEDULE\tDURATION\tMATCH\tSTATE")
+	for _, window := range windows {
+		state := "no start within a year"
+		if since := window.activeSince(now); !since.IsZero() {
+			state = "active until " + since.Add(time.Duration(window.Duration)*time.Second).Local().Format("2006-01-02 15:04")
+		} else if next := window.nextStart(now); !next.IsZero() {
+			state = "next at " + next.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", window.Name, window.Schedule, time.Duration(window.Duration)*time.Second, describeMatch(window.Match), state)
+	}
+	return w.Flush()
+}
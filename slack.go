@@ -0,0 +1,116 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const slackMaxTextLength = 2900
+
+type slackNotifier struct {
+	webhookURL string
+	client     *http.Client
+}
+
+// Block Kit payload for the Slack incoming webhooks
+// See: https://api.slack.com/reference/block-kit/blocks
+type slackMessage struct {
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+type slackBlock struct {
+	Type   string      `json:"type"`
+	Text   *slackText  `json:"text,omitempty"`
+	Fields []slackText `json:"fields,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+func newSlackNotifier(config adMonConfig) (notifier, error) {
+	if strings.TrimSpace(config.SlackTeamURL) == "" {
+		return nil, errors.New("the 'slackTeamURL' property is empty")
+	}
+
+	return &slackNotifier{
+		webhookURL: config.SlackTeamURL,
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (s *slackNotifier) name() string {
+	return "slack"
+}
+
+func (s *slackNotifier) notify(n notification) error {
+	return postJSON(s.client, s.webhookURL, buildSlackMessage(n), nil)
+}
+
+func buildSlackMessage(n notification) slackMessage {
+	title := ":rotating_light: " + n.title()
+	if n.State == alertResolved {
+		title = ":white_check_mark: " + n.title()
+	}
+
+	details := n.ErrorMessage
+	if n.Type != errorAlert {
+		lines := []string{}
+		for _, item := range n.Items {
+			lines = append(lines, "• "+strings.TrimSpace(item))
+		}
+		if len(n.Snoozed) > 0 {
+			lines = append(lines, "", "_Still failing, already notified:_")
+			for _, item := range n.Snoozed {
+				lines = append(lines, "• "+strings.TrimSpace(item))
+			}
+		}
+		details = strings.Join(lines, "\n")
+	}
+
+	// Slack rejects the section texts longer than 3000 characters
+	if truncated := truncateText(details, slackMaxTextLength); truncated != details {
+		details = truncated + "\n..."
+	}
+
+	return slackMessage{
+		// Fallback text for the notifications and the clients without Block Kit support
+		Text: fmt.Sprintf("%s on %s (%s)", n.title(), n.Host, n.APMServerIP),
+		Blocks: []slackBlock{
+			{
+				Type: "header",
+				Text: &slackText{Type: "plain_text", Text: title},
+			},
+			{
+				Type: "section",
+				Fields: []slackText{
+					{Type: "mrkdwn", Text: "*Host:*\n" + n.Host},
+					{Type: "mrkdwn", Text: "*APM Server IP:*\n" + n.APMServerIP},
+				},
+			},
+			{
+				Type: "section",
+				Text: &slackText{Type: "mrkdwn", Text: "```" + details + "```"},
+			},
+		},
+	}
+}
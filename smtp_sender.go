@@ -0,0 +1,276 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The 'smtp.tls' modes
+const (
+	// smtpTLSImplicit connects over TLS right away (SMTPS), the default on the port 465
+	smtpTLSImplicit = "implicit"
+	// smtpTLSStartTLS requires the server to upgrade the connection with STARTTLS
+	smtpTLSStartTLS = "starttls"
+	// smtpTLSOpportunistic upgrades the connection with STARTTLS only when the server offers it, the default on the other ports
+	smtpTLSOpportunistic = "opportunistic"
+	// smtpTLSNone never uses TLS, only meant for the local relays
+	smtpTLSNone = "none"
+)
+
+const (
+	defaultSMTPKeepAlive = 30
+	smtpDialTimeout      = 10 * time.Second
+)
+
+// smtpSender keeps the connection to the SMTP server open for a while after a mail is sent,
+// so the alerts going out together reuse the same connection
+type smtpSender struct {
+	addr      string
+	tlsMode   string
+	tlsConfig *tls.Config
+	auth      *smtpAuth
+	keepAlive time.Duration
+
+	mu        sync.Mutex
+	client    *smtp.Client
+	idleTimer *time.Timer
+}
+
+func newSMTPSender(config smtpConfig) (*smtpSender, error) {
+	tlsMode := strings.ToLower(config.TLS)
+	if tlsMode == "" {
+		tlsMode = smtpTLSOpportunistic
+		if config.Port == 465 {
+			tlsMode = smtpTLSImplicit
+		}
+	}
+	switch tlsMode {
+	case smtpTLSImplicit, smtpTLSStartTLS, smtpTLSOpportunistic, smtpTLSNone:
+	default:
+		return nil, fmt.Errorf("unsupported 'smtp.tls' mode '%s'. Supported modes: %s, %s, %s, %s", config.TLS, smtpTLSImplicit, smtpTLSStartTLS, smtpTLSOpportunistic, smtpTLSNone)
+	}
+
+	tlsConfig := &tls.Config{ServerName: config.Server, InsecureSkipVerify: config.InsecureSkipVerify}
+	if config.CAFile != "" {
+		caCerts, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			logErrorf("Cannot read the CA bundle at '%s'", config.CAFile)
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCerts) {
+			return nil, fmt.Errorf("no PEM certificate found in the CA bundle at '%s'", config.CAFile)
+		}
+	}
+
+	authMechanism := strings.ToLower(config.AuthMechanism)
+	switch authMechanism {
+	case "", "plain", "login", "cram-md5":
+	default:
+		return nil, fmt.Errorf("unsupported 'smtp.authMechanism' '%s'. Supported mechanisms: plain, login, cram-md5", config.AuthMechanism)
+	}
+
+	keepAlive := config.KeepAlive
+	if keepAlive == 0 {
+		keepAlive = defaultSMTPKeepAlive
+	}
+
+	sender := &smtpSender{
+		addr:      net.JoinHostPort(config.Server, strconv.Itoa(config.Port)),
+		tlsMode:   tlsMode,
+		tlsConfig: tlsConfig,
+		keepAlive: time.Duration(keepAlive) * time.Second,
+	}
+	if config.AuthEnabled {
+		sender.auth = &smtpAuth{mechanism: authMechanism, username: config.Username, password: config.Password, host: config.Server}
+	}
+	return sender, nil
+}
+
+// Send implements the gomail.Sender interface
+func (s *smtpSender) Send(from string, to []string, msg io.WriterTo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+	}
+
+	if err := s.send(from, to, msg); err != nil {
+		s.close()
+		return err
+	}
+
+	if s.keepAlive > 0 {
+		s.idleTimer = time.AfterFunc(s.keepAlive, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.close()
+		})
+	} else {
+		s.close()
+	}
+	return nil
+}
+
+func (s *smtpSender) send(from string, to []string, msg io.WriterTo) error {
+	// The server may have dropped the pooled connection in the meantime
+	if s.client != nil && s.client.Reset() != nil {
+		s.client.Close()
+		s.client = nil
+	}
+
+	if s.client == nil {
+		client, err := s.dial()
+		if err != nil {
+			return err
+		}
+		s.client = client
+	}
+
+	if err := s.client.Mail(from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := s.client.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+
+	w, err := s.client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := msg.WriteTo(w); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// dial connects, upgrades the connection to TLS as per the 'tls' mode and authenticates
+func (s *smtpSender) dial() (*smtp.Client, error) {
+	var conn net.Conn
+	var err error
+	if s.tlsMode == smtpTLSImplicit {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: smtpDialTimeout}, "tcp", s.addr, s.tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", s.addr, smtpDialTimeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := smtp.NewClient(conn, s.tlsConfig.ServerName)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if s.tlsMode == smtpTLSStartTLS || s.tlsMode == smtpTLSOpportunistic {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(s.tlsConfig); err != nil {
+				client.Close()
+				return nil, err
+			}
+		} else if s.tlsMode == smtpTLSStartTLS {
+			client.Close()
+			return nil, errors.New("the SMTP server does not support STARTTLS, which is required by the 'starttls' mode")
+		}
+	}
+
+	if s.auth != nil {
+		if err := client.Auth(s.auth.smtpAuth()); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+func (s *smtpSender) close() {
+	if s.client == nil {
+		return
+	}
+	if err := s.client.Quit(); err != nil {
+		s.client.Close()
+	}
+	s.client = nil
+}
+
+// smtpAuth holds the credentials and the mechanism of the 'smtp' config
+type smtpAuth struct {
+	mechanism string
+	username  string
+	password  string
+	host      string
+}
+
+// smtpAuth returns the configured mechanism. PLAIN is the default, as in the older versions,
+// since the servers may offer the other mechanisms without being able to check them.
+func (a *smtpAuth) smtpAuth() smtp.Auth {
+	switch a.mechanism {
+	case "login":
+		return &loginAuth{username: a.username, password: a.password}
+	case "cram-md5":
+		return smtp.CRAMMD5Auth(a.username, a.password)
+	default:
+		return smtp.PlainAuth("", a.username, a.password, a.host)
+	}
+}
+
+// loginAuth implements the LOGIN authentication mechanism, which net/smtp lacks
+type loginAuth struct {
+	username string
+	password string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("refusing the LOGIN authentication over an unencrypted connection")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch prompt := strings.ToLower(strings.TrimSpace(string(fromServer))); {
+	case strings.HasPrefix(prompt, "username"):
+		return []byte(a.username), nil
+	case strings.HasPrefix(prompt, "password"):
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected LOGIN authentication challenge '%s'", fromServer)
+	}
+}
+
+func isLocalhost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
@@ -0,0 +1,102 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/smtp"
+	"testing"
+)
+
+func TestSMTPAuthMechanism(t *testing.T) {
+	// The server offers all the mechanisms, the configured one must be used anyway
+	server := &smtp.ServerInfo{Name: "mail.example.com", TLS: true, Auth: []string{"CRAM-MD5", "LOGIN", "PLAIN"}}
+
+	tests := []struct {
+		name        string
+		authEnabled bool
+		mechanism   string
+		want        string
+		wantErr     bool
+	}{
+		{name: "default mechanism", authEnabled: true, want: "PLAIN"},
+		{name: "plain", authEnabled: true, mechanism: "plain", want: "PLAIN"},
+		{name: "login", authEnabled: true, mechanism: "login", want: "LOGIN"},
+		{name: "cram-md5", authEnabled: true, mechanism: "CRAM-MD5", want: "CRAM-MD5"},
+		{name: "unsupported mechanism", authEnabled: true, mechanism: "xoauth2", wantErr: true},
+		{name: "auth disabled", mechanism: "login"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sender, err := newSMTPSender(smtpConfig{Server: "mail.example.com", Port: 587, Username: "admon", Password: "secret", AuthEnabled: test.authEnabled, AuthMechanism: test.mechanism})
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("newSMTPSender() with the '%s' mechanism returned no error", test.mechanism)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newSMTPSender() returned the error: %s", err)
+			}
+
+			if test.want == "" {
+				if sender.auth != nil {
+					t.Errorf("newSMTPSender() set the '%s' auth, want none", sender.auth.mechanism)
+				}
+				return
+			}
+			got, _, err := sender.auth.smtpAuth().Start(server)
+			if err != nil {
+				t.Fatalf("Start() returned the error: %s", err)
+			}
+			if got != test.want {
+				t.Errorf("the '%s' mechanism authenticates with %s, want %s", test.mechanism, got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoginAuth(t *testing.T) {
+	auth := &loginAuth{username: "admon", password: "secret"}
+
+	if _, _, err := auth.Start(&smtp.ServerInfo{Name: "mail.example.com"}); err == nil {
+		t.Error("Start() over an unencrypted connection returned no error")
+	}
+	if _, _, err := auth.Start(&smtp.ServerInfo{Name: "localhost"}); err != nil {
+		t.Errorf("Start() to localhost returned the error: %s", err)
+	}
+
+	tests := []struct {
+		challenge string
+		more      bool
+		want      string
+		wantErr   bool
+	}{
+		{"Username:", true, "admon", false},
+		{"Password:", true, "secret", false},
+		{"Username:", false, "", false},
+		{"Token:", true, "", true},
+	}
+
+	for _, test := range tests {
+		got, err := auth.Next([]byte(test.challenge), test.more)
+		if (err != nil) != test.wantErr {
+			t.Errorf("Next(%q, %t) error = %v, want an error %t", test.challenge, test.more, err, test.wantErr)
+		}
+		if string(got) != test.want {
+			t.Errorf("Next(%q, %t) = %q, want %q", test.challenge, test.more, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	stateStoreFileName = ".admon.state.json"
+	stateStoreVersion  = 1
+	// maxNotificationHistory is the number of notification times kept per item
+	maxNotificationHistory = 20
+)
+
+const (
+	// legacyStateFile is where the older versions kept the last notified time of the missing containers
+	legacyStateFile = ".admon.state"
+	// legacyLastErrorFile is where the older versions kept the time of the last admon error
+	legacyLastErrorFile = "tmp/.admon.state"
+)
+
+// itemState tracks an alerted item (container, resource, admon error ...) across the checks
+type itemState struct {
+	FirstSeen    int64 `json:"firstSeen"`
+	LastNotified int64 `json:"lastNotified"`
+	// Notifications are the times the item was notified about, the latest ones only
+	Notifications []int64 `json:"notifications,omitempty"`
+	// NotificationCount is the number of notifications about the item since it started failing
+	NotificationCount int `json:"notificationCount,omitempty"`
+
+	// The threshold based items keep their last finding, so they can be resolved after a restart
+	Resource  string  `json:"resource,omitempty"`
+	Unit      string  `json:"unit,omitempty"`
+	Value     float64 `json:"value,omitempty"`
+	Threshold float64 `json:"threshold,omitempty"`
+	Peak      float64 `json:"peak,omitempty"`
+	Flag      bool    `json:"flag,omitempty"`
+}
+
+// notified records the LastNotified time in the notification history
+func (s itemState) notified() itemState {
+	s.NotificationCount++
+	s.Notifications = append(append([]int64{}, s.Notifications...), s.LastNotified)
+	if len(s.Notifications) > maxNotificationHistory {
+		s.Notifications = s.Notifications[len(s.Notifications)-maxNotificationHistory:]
+	}
+	return s
+}
+
+// stateData is the content of the state store file
+type stateData struct {
+	Version int `json:"version"`
+	// Alerts maps the alert types to the state of their alerted items
+	Alerts map[alertType]map[string]itemState `json:"alerts"`
+	// Silences are managed by the 'silence' command
+	Silences []silence `json:"silences,omitempty"`
+}
+
+// stateStore keeps the state of all the alerts in a single versioned file.
+// The file is replaced atomically on every update, so a crash never leaves it half written.
+type stateStore struct {
+	path string
+
+	mu   sync.Mutex
+	data stateData
+}
+
+// openStateStore loads the state store of the config directory, importing the state files of the older versions on the first run.
+// A state file which cannot be loaded is set aside and the store starts empty, so admon keeps running. The error tells why.
+func openStateStore(configDir string) (*stateStore, error) {
+	s := &stateStore{
+		path: filepath.Join(configDir, stateStoreFileName),
+		data: stateData{Version: stateStoreVersion, Alerts: map[alertType]map[string]itemState{}},
+	}
+
+	content, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, s.migrate(configDir)
+	} else if err != nil {
+		return s, setAside(s.path, fmt.Errorf("cannot read the state file at '%s'. Because: %s", s.path, err.Error()))
+	}
+
+	data := stateData{}
+	if err := json.Unmarshal(content, &data); err != nil {
+		return s, setAside(s.path, fmt.Errorf("cannot unmarshal the state file at '%s'. Because: %s", s.path, err.Error()))
+	}
+	if data.Version > stateStoreVersion {
+		return s, setAside(s.path, fmt.Errorf("the state file at '%s' was written by a newer version of admon (state version %d)", s.path, data.Version))
+	}
+	if data.Alerts == nil {
+		data.Alerts = map[alertType]map[string]itemState{}
+	}
+	data.Version = stateStoreVersion
+	s.data = data
+
+	return s, nil
+}
+
+// setAside renames the state file which cannot be loaded, so it is kept for a look but not loaded again.
+// It returns the load error, telling where the file went.
+func setAside(path string, loadErr error) error {
+	badPath := fmt.Sprintf("%s.bad-%d", path, time.Now().Unix())
+	if err := os.Rename(path, badPath); err != nil {
+		return fmt.Errorf("%s. Starting with an empty state, but cannot move the file aside. Because: %s", loadErr.Error(), err.Error())
+	}
+	return fmt.Errorf("%s. Starting with an empty state, the file was moved to '%s'", loadErr.Error(), badPath)
+}
+
+// migrate imports the legacy state file, then removes it along with the legacy last error file
+func (s *stateStore) migrate(configDir string) error {
+	legacyFile := filepath.Join(configDir, legacyStateFile)
+	content, err := ioutil.ReadFile(legacyFile)
+	if err != nil && !os.IsNotExist(err) {
+		return setAside(legacyFile, fmt.Errorf("cannot read the state file at '%s'. Because: %s", legacyFile, err.Error()))
+	}
+
+	imported := []string{}
+	if err == nil {
+		// The older versions stored only the last notified time per missing container
+		legacyItems := map[string]int64{}
+		if err := json.Unmarshal(content, &legacyItems); err != nil {
+			return setAside(legacyFile, fmt.Errorf("cannot unmarshal the state file at '%s'. Because: %s", legacyFile, err.Error()))
+		}
+
+		items := map[string]itemState{}
+		for item, lastTime := range legacyItems {
+			items[item] = itemState{FirstSeen: lastTime, LastNotified: lastTime}
+		}
+		if len(items) > 0 {
+			s.data.Alerts[containerAlert] = items
+		}
+		imported = append(imported, legacyFile)
+	}
+
+	// The last error time is not worth importing, the admon errors are tracked per error message now
+	if _, err := os.Stat(filepath.Join(configDir, legacyLastErrorFile)); err == nil {
+		imported = append(imported, filepath.Join(configDir, legacyLastErrorFile))
+	}
+
+	if len(imported) == 0 {
+		return nil
+	}
+
+	if err := s.save(); err != nil {
+		return err
+	}
+	for _, legacyFile := range imported {
+		logInfof("Imported the state file at '%s' into '%s'", legacyFile, s.path)
+		if err := os.Remove(legacyFile); err != nil {
+			logErrorf("Cannot remove the old state file at '%s'. Because: %s", legacyFile, err.Error())
+		}
+	}
+	return nil
+}
+
+// items returns a copy of the state of the items of the alert type
+func (s *stateStore) items(alert alertType) map[string]itemState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := map[string]itemState{}
+	for item, state := range s.data.Alerts[alert] {
+		items[item] = state
+	}
+	return items
+}
+
+// setItems replaces the state of the items of the alert type and saves the store.
+// The state is replaced in memory even when it cannot be saved.
+func (s *stateStore) setItems(alert alertType, items map[string]itemState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(items) == 0 {
+		if _, ok := s.data.Alerts[alert]; !ok {
+			return nil
+		}
+		delete(s.data.Alerts, alert)
+	} else {
+		s.data.Alerts[alert] = items
+	}
+	return s.save()
+}
+
+// silences returns the silences which are not over yet, reloaded from the file as the 'silence' command may have changed them
+func (s *stateStore) silences() []silence {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reloadSilences()
+	return pruneSilences(s.data.Silences, time.Now())
+}
+
+// updateSilences changes the silences for the 'silence' command. The whole file is reloaded first,
+// as the running daemon may have updated the alerts in the meantime.
+func (s *stateStore) updateSilences(update func(silences []silence) ([]silence, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if content, err := ioutil.ReadFile(s.path); err == nil {
+		data := stateData{}
+		if err := json.Unmarshal(content, &data); err != nil {
+			logErrorf("Cannot unmarshal the state file at '%s'", s.path)
+			return err
+		}
+		if data.Alerts == nil {
+			data.Alerts = map[alertType]map[string]itemState{}
+		}
+		data.Version = stateStoreVersion
+		s.data = data
+	}
+
+	silences, err := update(pruneSilences(s.data.Silences, time.Now()))
+	if err != nil {
+		return err
+	}
+	s.data.Silences = silences
+	return s.write()
+}
+
+// reloadSilences picks up the silences of the file, keeping the known ones when the file cannot be read
+func (s *stateStore) reloadSilences() {
+	content, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return
+	}
+	data := stateData{}
+	if err := json.Unmarshal(content, &data); err == nil {
+		s.data.Silences = data.Silences
+	}
+}
+
+// save writes the alerts along with the current silences of the file, dropping the silences which are over
+func (s *stateStore) save() error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s.reloadSilences()
+	s.data.Silences = pruneSilences(s.data.Silences, time.Now())
+	return s.write()
+}
+
+// lock takes the exclusive lock of the state file, shared by the daemon and the 'silence' command, so their
+// read-modify-write cycles never interleave. The returned function releases it.
+func (s *stateStore) lock() (func(), error) {
+	file, err := os.OpenFile(s.path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		logErrorf("Cannot open the lock file of the state file at '%s'", s.path)
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		logErrorf("Cannot lock the state file at '%s'", s.path)
+		file.Close()
+		return nil, err
+	}
+
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
+
+func (s *stateStore) write() error {
+	content, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		logError("Cannot marshal the state")
+		return err
+	}
+	return writeFileAtomic(s.path, content)
+}
@@ -0,0 +1,128 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// stateFiles lists the files of the config directory, but the lock file, with the times of the set aside files left out
+func stateFiles(t *testing.T, dir string) []string {
+	files := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || strings.HasSuffix(path, ".lock") {
+			return err
+		}
+		name, _ := filepath.Rel(dir, path)
+		files = append(files, regexp.MustCompile(`\.bad-\d+$`).ReplaceAllString(name, ".bad"))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("cannot list the config directory: %s", err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestOpenStateStore(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      map[string]string
+		wantAlerts map[alertType]map[string]itemState
+		wantErr    bool
+		wantFiles  []string
+	}{
+		{
+			name:       "first run",
+			wantAlerts: map[alertType]map[string]itemState{},
+			wantFiles:  []string{},
+		},
+		{
+			name:       "state file",
+			files:      map[string]string{".admon.state.json": `{"version":1,"alerts":{"health":{"web":{"firstSeen":100,"lastNotified":200}}}}`},
+			wantAlerts: map[alertType]map[string]itemState{healthAlert: {"web": {FirstSeen: 100, LastNotified: 200}}},
+			wantFiles:  []string{".admon.state.json"},
+		},
+		{
+			name:       "legacy state files",
+			files:      map[string]string{".admon.state": `{"web":100,"db":200}`, "tmp/.admon.state": `300`},
+			wantAlerts: map[alertType]map[string]itemState{containerAlert: {"web": {FirstSeen: 100, LastNotified: 100}, "db": {FirstSeen: 200, LastNotified: 200}}},
+			wantFiles:  []string{".admon.state.json"},
+		},
+		{
+			name:       "empty legacy state file",
+			files:      map[string]string{".admon.state": `{}`},
+			wantAlerts: map[alertType]map[string]itemState{},
+			wantFiles:  []string{".admon.state.json"},
+		},
+		{
+			name:       "corrupted legacy state file",
+			files:      map[string]string{".admon.state": `{"web":`},
+			wantAlerts: map[alertType]map[string]itemState{},
+			wantErr:    true,
+			wantFiles:  []string{".admon.state.bad"},
+		},
+		{
+			name:       "corrupted state file",
+			files:      map[string]string{".admon.state.json": `{"version":1,"alerts":{"health":`},
+			wantAlerts: map[alertType]map[string]itemState{},
+			wantErr:    true,
+			wantFiles:  []string{".admon.state.json.bad"},
+		},
+		{
+			name:       "state file of a newer version",
+			files:      map[string]string{".admon.state.json": `{"version":2,"alerts":{"health":{"web":{"firstSeen":100}}}}`},
+			wantAlerts: map[alertType]map[string]itemState{},
+			wantErr:    true,
+			wantFiles:  []string{".admon.state.json.bad"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range test.files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatalf("cannot create the directory of '%s': %s", name, err)
+				}
+				if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatalf("cannot write '%s': %s", name, err)
+				}
+			}
+
+			store, err := openStateStore(dir)
+			if (err != nil) != test.wantErr {
+				t.Errorf("openStateStore() error = %v, want an error %t", err, test.wantErr)
+			}
+			if store == nil {
+				t.Fatal("openStateStore() returned no store")
+			}
+			if !reflect.DeepEqual(store.data.Alerts, test.wantAlerts) {
+				t.Errorf("openStateStore() alerts = %+v, want %+v", store.data.Alerts, test.wantAlerts)
+			}
+			if files := stateFiles(t, dir); !reflect.DeepEqual(files, test.wantFiles) {
+				t.Errorf("files left = %v, want %v", files, test.wantFiles)
+			}
+		})
+	}
+}
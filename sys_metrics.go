@@ -17,6 +17,8 @@ package main
 import (
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/shirou/gopsutil/v3/cpu"
@@ -37,13 +39,353 @@ type sysStats struct {
 	memUsagePercentage  float64
 	diskUsagePercentage map[string]float64
 	directorySize       map[string]int64
+	// cpuKnown & memKnown tell whether the CPU & memory usages could be fetched. The disks and
+	// directories which could not be measured are missing from their maps.
+	cpuKnown bool
+	memKnown bool
 }
 
-func (sw *sysWatcher) watchSystemResources() []string {
+// sysFinding is a single system resource which reached its threshold
+type sysFinding struct {
+	key       string
+	resource  string
+	unit      string
+	value     float64
+	threshold float64
+	message   string
+	// flag findings are either set or not, e.g. the OOM killed state of a container
+	flag bool
+}
+
+func (f sysFinding) formatValue(value float64) string {
+	switch f.unit {
+	case "%":
+		return fmt.Sprintf("%.2f%%", value)
+	case "":
+		return fmt.Sprintf("%d", int64(value))
+	default:
+		return fmt.Sprintf("%d %s", int64(value), f.unit)
+	}
+}
+
+// itemValue is the value of the finding vs its threshold
+func (f sysFinding) itemValue() itemValue {
+	if f.flag {
+		return itemValue{}
+	}
+	return itemValue{Value: f.formatValue(f.value), Threshold: f.formatValue(f.threshold)}
+}
+
+// sysAlert tracks a firing system resource alert until it gets resolved
+type sysAlert struct {
+	finding       sysFinding
+	firstSeen     time.Time
+	peak          float64
+	lastNotified  int64
+	notifications []int64
+	// notificationCount is the number of notifications since the alert started firing
+	notificationCount int
+}
+
+// state is the alert as kept in the state store
+func (a *sysAlert) state() itemState {
+	return itemState{
+		FirstSeen:         a.firstSeen.Unix(),
+		LastNotified:      a.lastNotified,
+		Notifications:     a.notifications,
+		NotificationCount: a.notificationCount,
+		Resource:          a.finding.resource,
+		Unit:              a.finding.unit,
+		Value:             a.finding.value,
+		Threshold:         a.finding.threshold,
+		Peak:              a.peak,
+		Flag:              a.finding.flag,
+	}
+}
+
+// restoreSysAlert rebuilds the alert from the state store, after a restart
+func restoreSysAlert(key string, state itemState) *sysAlert {
+	return &sysAlert{
+		finding: sysFinding{
+			key:       key,
+			resource:  state.Resource,
+			unit:      state.Unit,
+			value:     state.Value,
+			threshold: state.Threshold,
+			flag:      state.Flag,
+		},
+		firstSeen:         time.Unix(state.FirstSeen, 0),
+		peak:              state.Peak,
+		lastNotified:      state.LastNotified,
+		notifications:     state.Notifications,
+		notificationCount: state.NotificationCount,
+	}
+}
+
+func (a *sysAlert) resolvedMessage(now time.Time) string {
+	if a.finding.flag {
+		return fmt.Sprintf("%s is cleared. Lasted for %s\n", a.finding.resource, now.Sub(a.firstSeen).Round(time.Second))
+	}
+	return fmt.Sprintf("%s is back below the threshold value of '%s'. Peak value: '%s'. Lasted for %s\n", a.finding.resource, a.finding.formatValue(a.finding.threshold), a.finding.formatValue(a.peak), now.Sub(a.firstSeen).Round(time.Second))
+}
+
+// sysAlertTracker follows the firing / resolved transitions of the system resource alerts
+type sysAlertTracker struct {
+	active map[string]*sysAlert
+}
+
+func newSysAlertTracker() *sysAlertTracker {
+	return &sysAlertTracker{active: map[string]*sysAlert{}}
+}
+
+// update records the current findings and returns the newly firing and the resolved alerts.
+// The alerts of the 'unknown' resources, which could not be measured, stay active.
+func (t *sysAlertTracker) update(findings []sysFinding, unknown map[string]bool, now time.Time) ([]sysFinding, []*sysAlert) {
+	newlyFiring := []sysFinding{}
+	resolved := []*sysAlert{}
+	seen := map[string]bool{}
+
+	for _, finding := range findings {
+		seen[finding.key] = true
+		if alert, ok := t.active[finding.key]; ok {
+			alert.finding = finding
+			if finding.value > alert.peak {
+				alert.peak = finding.value
+			}
+			continue
+		}
+		t.active[finding.key] = &sysAlert{finding: finding, firstSeen: now, peak: finding.value}
+		newlyFiring = append(newlyFiring, finding)
+	}
+
+	for key, alert := range t.active {
+		if !seen[key] && !unknown[key] {
+			resolved = append(resolved, alert)
+			delete(t.active, key)
+		}
+	}
+	sort.Slice(resolved, func(i, j int) bool { return resolved[i].finding.key < resolved[j].finding.key })
+
+	return newlyFiring, resolved
+}
+
+// thresholdAlerter sends the alerts and the resolved notifications of the threshold based checks
+type thresholdAlerter struct {
+	alert   alertType
+	policy  escalationPolicy
+	tracker *sysAlertTracker
+	store   *stateStore
+}
+
+// newThresholdAlerter restores the firing alerts from the state store
+func newThresholdAlerter(alert alertType, policy escalationPolicy, store *stateStore) *thresholdAlerter {
+	a := &thresholdAlerter{
+		alert:   alert,
+		policy:  policy,
+		tracker: newSysAlertTracker(),
+		store:   store,
+	}
+
+	for key, state := range store.items(alert) {
+		a.tracker.active[key] = restoreSysAlert(key, state)
+	}
+	return a
+}
+
+// save keeps the firing alerts in the state store
+func (a *thresholdAlerter) save() {
+	states := map[string]itemState{}
+	for key, alert := range a.tracker.active {
+		states[key] = alert.state()
+	}
+	if err := a.store.setItems(a.alert, states); err != nil {
+		logErrorf("Cannot save the state of the %s alerts. Because: %s", a.alert, err.Error())
+	}
+}
+
+// process sends the alert for the current findings, unless snoozed or silenced, and the resolved notification for the cleared ones.
+// The alerts of the 'unknown' resources are neither notified nor resolved.
+func (a *thresholdAlerter) process(notifiers *dispatcher, configData adMonConfig, findings []sysFinding, unknown map[string]bool) {
+	currentTime := time.Unix(time.Now().Unix(), 0)
+	newlyFiring, resolved := a.tracker.update(findings, unknown, currentTime)
+	defer a.save()
+
+	// The silenced resources are tracked, so they get resolved, but they are neither notified nor counted as notified
+	silencedKeys := []string{}
+	for _, finding := range findings {
+		silencedKeys = append(silencedKeys, finding.key)
+	}
+	for _, alert := range resolved {
+		silencedKeys = append(silencedKeys, alert.finding.key)
+	}
+	silenced := silencedItems(a.store, configData, notification{Type: a.alert, Keys: silencedKeys}, currentTime)
+
+	//
+	if len(findings) > 0 {
+		isNew := map[string]bool{}
+		for _, finding := range newlyFiring {
+			isNew[finding.key] = true
+		}
+
+		// Each resource has its own snooze time: the new resources and the ones whose snooze time is over are due,
+		// the other ones are only listed as context
+		var nextMailEpoch time.Time
+		messages, keys, values, firstSeen := []string{}, []string{}, []itemValue{}, []time.Time{}
+		dueIndexes, snoozedIndexes, silencedIndexes := []int{}, []int{}, []int{}
+		for i, finding := range findings {
+			alert := a.tracker.active[finding.key]
+			condition := "above the threshold"
+			if finding.flag {
+				condition = "firing"
+			}
+			message := failingMessage(strings.TrimSuffix(finding.message, "\n"), condition, itemState{FirstSeen: alert.firstSeen.Unix()}, isNew[finding.key], currentTime.Unix())
+			messages = append(messages, message+"\n")
+			keys = append(keys, finding.key)
+			values = append(values, finding.itemValue())
+			firstSeen = append(firstSeen, alert.firstSeen)
+
+			if _, ok := silenced[finding.key]; ok {
+				silencedIndexes = append(silencedIndexes, i)
+				continue
+			}
+			next := time.Unix(a.policy.nextNotification(alert.state()), 0)
+			if isNew[finding.key] || !currentTime.Before(next) {
+				dueIndexes = append(dueIndexes, i)
+				continue
+			}
+			snoozedIndexes = append(snoozedIndexes, i)
+			if nextMailEpoch.IsZero() || next.Before(nextMailEpoch) {
+				nextMailEpoch = next
+			}
+		}
+
+		logInfof("%s ...", notification{Type: a.alert}.title())
+		logInfo(messages)
+
+		findingItems := notification{
+			Type:        a.alert,
+			APMServerIP: configData.APMServerIP,
+			Items:       messages,
+			Keys:        keys,
+			Values:      values,
+			FirstSeen:   firstSeen,
+		}
+		if len(silencedIndexes) > 0 {
+			logInfof("Silenced (%s): %v", a.alert, findingItems.subset(silencedIndexes).Keys)
+			notifiers.history.recordSilenced(findingItems.subset(silencedIndexes), silenced)
+		}
+		firing, snoozed := findingItems.subset(dueIndexes), findingItems.subset(snoozedIndexes)
+		firing.Snoozed, firing.SnoozedKeys = snoozed.Items, snoozed.Keys
+
+		// Sends the alert when any resource newly reached its threshold or when the snooze time of any resource is over
+		if len(firing.Keys) > 0 {
+			// The resources silenced so far are notified for the first time too
+			firstNotified := map[string]bool{}
+			for _, key := range firing.Keys {
+				firstNotified[key] = isNew[key] || a.tracker.active[key].lastNotified == 0
+			}
+			notifiers.history.recordFiring(firing, firstNotified)
+
+			// The resources notified too many times are escalated
+			escalated := []int{}
+			for i, key := range firing.Keys {
+				if a.policy.escalates(a.tracker.active[key].notificationCount + 1) {
+					escalated = append(escalated, i)
+				}
+			}
+
+			// send the alert. The resources are notified even if a channel failed, the outbox retries the failed deliveries.
+			logInfo("Trying to send the notification ... ")
+			if err := notifiers.dispatch(firing); err != nil {
+				logError(err.Error())
+			} else {
+				logInfo("Notification Sent!")
+			}
+			// Only the due resources count as notified, so each resource follows its own repeat & escalation schedule
+			for _, key := range firing.Keys {
+				alert := a.tracker.active[key]
+				state := itemState{LastNotified: currentTime.Unix(), Notifications: alert.notifications, NotificationCount: alert.notificationCount}.notified()
+				alert.lastNotified, alert.notifications, alert.notificationCount = state.LastNotified, state.Notifications, state.NotificationCount
+			}
+
+			if len(escalated) > 0 {
+				logInfof("Escalating (%s) via %v: %v", a.alert, a.policy.channels, firing.subset(escalated).Keys)
+				if err := notifiers.escalate(firing.subset(escalated), a.policy); err != nil {
+					logError(err.Error())
+				}
+			}
+		}
+		if len(snoozed.Keys) > 0 {
+			// Snooze
+			logInfof("Snoozing %v until - '%s'. Current time is: '%s'", snoozed.Keys, nextMailEpoch.Format("2006-01-02T15:04:05.000Z"), currentTime.Format("2006-01-02T15:04:05.000Z"))
+			notifiers.history.record(historySnoozed, snoozed, "", nil)
+			notifiers.refresh(snoozed)
+		}
+	}
+
+	if len(resolved) > 0 {
+		messages, keys, values, firstSeen := []string{}, []string{}, []itemValue{}, []time.Time{}
+		notifiableIndexes, mutedIndexes := []int{}, []int{}
+		for i, alert := range resolved {
+			messages = append(messages, alert.resolvedMessage(currentTime))
+			keys = append(keys, alert.finding.key)
+			firstSeen = append(firstSeen, alert.firstSeen)
+
+			value := itemValue{}
+			if !alert.finding.flag {
+				value.Threshold = alert.finding.formatValue(alert.finding.threshold)
+				value.Peak = alert.finding.formatValue(alert.peak)
+			}
+			values = append(values, value)
+
+			// The resources never notified, as they were silenced while firing, are resolved silently.
+			// The notified ones are resolved even when silenced now, so their incidents & threads get closed.
+			if alert.lastNotified == 0 {
+				mutedIndexes = append(mutedIndexes, i)
+			} else {
+				notifiableIndexes = append(notifiableIndexes, i)
+			}
+		}
+
+		logInfof("%s ...", notification{Type: a.alert, State: alertResolved}.title())
+		logInfo(messages)
+
+		resolvedItems := notification{
+			Type:        a.alert,
+			State:       alertResolved,
+			APMServerIP: configData.APMServerIP,
+			Items:       messages,
+			Keys:        keys,
+			Values:      values,
+			FirstSeen:   firstSeen,
+		}
+		if len(mutedIndexes) > 0 {
+			logInfof("Resolved silently (%s): %v", a.alert, resolvedItems.subset(mutedIndexes).Keys)
+			notifiers.history.recordSilenced(resolvedItems.subset(mutedIndexes), silenced)
+		}
+
+		if len(notifiableIndexes) > 0 {
+			resolvedNotification := resolvedItems.subset(notifiableIndexes)
+			notifiers.history.record(historyResolved, resolvedNotification, "", nil)
+
+			// send the recovery notification
+			logInfo("Trying to send the notification ... ")
+			if err := notifiers.dispatch(resolvedNotification); err != nil {
+				logError(err.Error())
+			} else {
+				logInfo("Notification Sent!")
+			}
+		}
+	}
+}
+
+// watchSystemResources returns the resources which reached their threshold, and the keys of the ones which could not be measured
+func (sw *sysWatcher) watchSystemResources() ([]sysFinding, map[string]bool) {
 	diskMounts := []string{}
 	dirList := []string{}
 	cpuStatInterval := 1
-	messages := []string{}
+	findings := []sysFinding{}
+	unknown := map[string]bool{}
 
 	for diskMount := range sw.diskThreshold {
 		diskMounts = append(diskMounts, diskMount)
@@ -59,31 +401,65 @@ func (sw *sysWatcher) watchSystemResources() []string {
 
 	currentStat := sysMetrics(cpuStatInterval, diskMounts, dirList)
 
-	if sw.cpuThreshold != 0 && currentStat.cpuUsagePercentage >= sw.cpuThreshold {
-		messages = append(messages, fmt.Sprintf("CPU utilisation reached '%.2f%%'. Current threshold value: '%.2f%%'\n", currentStat.cpuUsagePercentage, sw.cpuThreshold))
+	if sw.cpuThreshold != 0 && !currentStat.cpuKnown {
+		unknown["cpu"] = true
+	} else if sw.cpuThreshold != 0 && currentStat.cpuUsagePercentage >= sw.cpuThreshold {
+		findings = append(findings, sysFinding{
+			key:       "cpu",
+			resource:  "CPU utilisation",
+			unit:      "%",
+			value:     currentStat.cpuUsagePercentage,
+			threshold: sw.cpuThreshold,
+			message:   fmt.Sprintf("CPU utilisation reached '%.2f%%'. Current threshold value: '%.2f%%'\n", currentStat.cpuUsagePercentage, sw.cpuThreshold),
+		})
 	}
 
-	if sw.memThreshold != 0 && currentStat.memUsagePercentage >= sw.memThreshold {
-		messages = append(messages, fmt.Sprintf("Memory utilisation reached '%.2f%%'. Current threshold value: '%.2f%%'\n", currentStat.memUsagePercentage, sw.memThreshold))
+	if sw.memThreshold != 0 && !currentStat.memKnown {
+		unknown["memory"] = true
+	} else if sw.memThreshold != 0 && currentStat.memUsagePercentage >= sw.memThreshold {
+		findings = append(findings, sysFinding{
+			key:       "memory",
+			resource:  "Memory utilisation",
+			unit:      "%",
+			value:     currentStat.memUsagePercentage,
+			threshold: sw.memThreshold,
+			message:   fmt.Sprintf("Memory utilisation reached '%.2f%%'. Current threshold value: '%.2f%%'\n", currentStat.memUsagePercentage, sw.memThreshold),
+		})
 	}
 
 	for diskMount, threshold := range sw.diskThreshold {
-		if currentUsage, ok := currentStat.diskUsagePercentage[diskMount]; ok {
-			if threshold != 0 && currentUsage >= threshold {
-				messages = append(messages, fmt.Sprintf("Disk utilisation reached '%.2f%%' for the mount point '%s'. Current threshold value: '%.2f%%'\n", currentUsage, diskMount, threshold))
-			}
+		currentUsage, ok := currentStat.diskUsagePercentage[diskMount]
+		if !ok {
+			unknown["disk:"+diskMount] = true
+		} else if threshold != 0 && currentUsage >= threshold {
+			findings = append(findings, sysFinding{
+				key:       "disk:" + diskMount,
+				resource:  fmt.Sprintf("Disk utilisation for the mount point '%s'", diskMount),
+				unit:      "%",
+				value:     currentUsage,
+				threshold: threshold,
+				message:   fmt.Sprintf("Disk utilisation reached '%.2f%%' for the mount point '%s'. Current threshold value: '%.2f%%'\n", currentUsage, diskMount, threshold),
+			})
 		}
 	}
 
 	for directoryPath, threshold := range sw.dirThreshold {
-		if currentUsage, ok := currentStat.directorySize[directoryPath]; ok {
-			if threshold != 0 && currentUsage >= threshold {
-				messages = append(messages, fmt.Sprintf("Directory Size Reached Threshold of '%d' bytes for the path '%s'. Current threshold value: '%d'\n", currentUsage, directoryPath, threshold))
-			}
+		currentUsage, ok := currentStat.directorySize[directoryPath]
+		if !ok {
+			unknown["dir:"+directoryPath] = true
+		} else if threshold != 0 && currentUsage >= threshold {
+			findings = append(findings, sysFinding{
+				key:       "dir:" + directoryPath,
+				resource:  fmt.Sprintf("Directory size for the path '%s'", directoryPath),
+				unit:      "bytes",
+				value:     float64(currentUsage),
+				threshold: float64(threshold),
+				message:   fmt.Sprintf("Directory Size Reached Threshold of '%d' bytes for the path '%s'. Current threshold value: '%d'\n", currentUsage, directoryPath, threshold),
+			})
 		}
 	}
 
-	return messages
+	return findings, unknown
 }
 
 func sysMetrics(cpuStatInterval int, diskMounts, dirList []string) sysStats {
@@ -108,24 +484,27 @@ func sysMetrics(cpuStatInterval int, diskMounts, dirList []string) sysStats {
 func (s *sysStats) fetchCPUStats(interval int) {
 	cpuUsage, err := cpu.Percent(time.Duration(interval)*time.Second, false)
 	if err != nil {
-		fmt.Println("ERROR: Cannot fetch CPU stats. Because: ", err.Error())
+		logError("Cannot fetch CPU stats. Because:", err.Error())
 		return
 	}
 
 	lenOfUsage := len(cpuUsage)
 	if lenOfUsage == 1 {
 		s.cpuUsagePercentage = cpuUsage[0]
+		s.cpuKnown = true
 		return
 	}
-	fmt.Printf("ERROR: Unexpected CPU usage length of '%d' detected\n", lenOfUsage)
+	logErrorf("Unexpected CPU usage length of '%d' detected", lenOfUsage)
 }
 
 func (s *sysStats) fetchMemStats() {
 	vMemory, err := mem.VirtualMemory()
 	if err != nil {
-		fmt.Println("ERROR: Cannot fetch memory stats. Because: ", err.Error())
+		logError("Cannot fetch memory stats. Because:", err.Error())
+		return
 	}
 	s.memUsagePercentage = vMemory.UsedPercent
+	s.memKnown = true
 }
 
 func (s *sysStats) fetchDiskStats(mountPoints []string) {
@@ -133,7 +512,7 @@ func (s *sysStats) fetchDiskStats(mountPoints []string) {
 
 	partitions, err := disk.Partitions(true)
 	if err != nil {
-		fmt.Println("ERROR: Cannot fetch disk partitions. Because: ", err.Error())
+		logError("Cannot fetch disk partitions. Because:", err.Error())
 		return
 	}
 
@@ -141,7 +520,7 @@ func (s *sysStats) fetchDiskStats(mountPoints []string) {
 	for _, partition := range partitions {
 		usage, err := disk.Usage(partition.Mountpoint)
 		if err != nil {
-			fmt.Printf("ERROR: Cannot fetch disk usage for the path '%s'. Because: %s\n", partition.Mountpoint, err.Error())
+			logErrorf("Cannot fetch disk usage for the path '%s'. Because: %s", partition.Mountpoint, err.Error())
 		} else {
 			partitionMap[partition.Mountpoint] = usage.UsedPercent
 		}
@@ -165,7 +544,7 @@ func (s *sysStats) fetchDirSize(directories []string) {
 			dirSize := getDirSize(directory, info)
 			result[directory] = dirSize
 		} else {
-			fmt.Printf("ERROR: Cannot fetch directory size of the path '%s'. Because: %s\n", directory, err.Error())
+			logErrorf("Cannot fetch directory size of the path '%s'. Because: %s", directory, err.Error())
 		}
 	}
 
@@ -194,7 +573,7 @@ func getDirSize(currentPath string, info os.FileInfo) int64 {
 			size += getDirSize(currentPath+"/"+fi.Name(), fi)
 		}
 	} else {
-		fmt.Printf("ERROR: Cannot read the directory at path: '%s'. Because: %s\n", currentPath, err.Error())
+		logErrorf("Cannot read the directory at path: '%s'. Because: %s", currentPath, err.Error())
 	}
 
 	return size
@@ -0,0 +1,178 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSyslogSocket = "/dev/log"
+	// syslogSDID is the SD-ID of the admon structured data, under the enterprise number reserved for the documentation
+	syslogSDID = "admon@32473"
+)
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslogWriter sends RFC 5424 messages over UDP, TCP or a unix socket
+type syslogWriter struct {
+	network  string
+	address  string
+	facility int
+	hostname string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newSyslogWriter(config syslogConfig) (*syslogWriter, error) {
+	network := config.Network
+	if network == "" {
+		network = "unix"
+	}
+	if network != "unix" && network != "udp" && network != "tcp" {
+		return nil, fmt.Errorf("unsupported syslog network '%s'. Supported networks: unix, udp, tcp", network)
+	}
+
+	address := config.Address
+	if address == "" {
+		if network != "unix" {
+			return nil, fmt.Errorf("the 'syslog.address' property is needed for the '%s' network", network)
+		}
+		address = defaultSyslogSocket
+	}
+
+	facilityName := config.Facility
+	if facilityName == "" {
+		facilityName = "daemon"
+	}
+	facility, ok := syslogFacilities[facilityName]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility '%s'", facilityName)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "-"
+	}
+
+	w := &syslogWriter{network: network, address: address, facility: facility, hostname: hostname}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *syslogWriter) connect() error {
+	if w.network != "unix" {
+		conn, err := net.DialTimeout(w.network, w.address, 10*time.Second)
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+		return nil
+	}
+
+	// The local syslog daemons listen on a datagram socket, some on a stream socket
+	conn, err := net.Dial("unixgram", w.address)
+	if err != nil {
+		conn, err = net.Dial("unix", w.address)
+		if err != nil {
+			return err
+		}
+	}
+	w.conn = conn
+	return nil
+}
+
+func (w *syslogWriter) writeLog(severity int, msgID, message string, fields map[string]string) error {
+	record := w.format(severity, msgID, message, fields)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Re-connects once, e.g. after a restart of the syslog daemon
+	for attempt := 0; ; attempt++ {
+		if w.conn == nil {
+			if err := w.connect(); err != nil {
+				return err
+			}
+		}
+		_, err := w.conn.Write(record)
+		if err == nil {
+			return nil
+		}
+		w.conn.Close()
+		w.conn = nil
+		if attempt > 0 {
+			return err
+		}
+	}
+}
+
+// format builds the RFC 5424 message, with the octet counting framing on TCP (RFC 6587)
+func (w *syslogWriter) format(severity int, msgID, message string, fields map[string]string) []byte {
+	structuredData := "-"
+	if len(fields) > 0 {
+		names := []string{}
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		params := []string{syslogSDID}
+		for _, name := range names {
+			params = append(params, fmt.Sprintf("%s=\"%s\"", name, syslogParamEscaper.Replace(fields[name])))
+		}
+		structuredData = "[" + strings.Join(params, " ") + "]"
+	}
+
+	// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+	record := fmt.Sprintf("<%d>1 %s %s admon %d %s %s %s",
+		w.facility*8+severity,
+		time.Now().Format("2006-01-02T15:04:05.000000Z07:00"),
+		w.hostname,
+		os.Getpid(),
+		msgID,
+		structuredData,
+		message,
+	)
+
+	if w.network == "tcp" {
+		return []byte(fmt.Sprintf("%d %s", len(record), record))
+	}
+	return []byte(record)
+}
+
+// syslogParamEscaper escapes the characters not allowed in the SD-PARAM values
+var syslogParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+func newSyslogNotifier(config adMonConfig) (notifier, error) {
+	writer, err := newSyslogWriter(config.Syslog)
+	if err != nil {
+		return nil, err
+	}
+	return &logNotifier{channel: "syslog", sink: writer}, nil
+}
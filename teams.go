@@ -0,0 +1,140 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type teamsNotifier struct {
+	webhookURL string
+	client     *http.Client
+}
+
+// Adaptive Card message for the Teams incoming webhooks
+// See: https://learn.microsoft.com/en-us/microsoftteams/platform/webhooks-and-connectors/how-to/connectors-using
+type teamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+type teamsAttachment struct {
+	ContentType string    `json:"contentType"`
+	Content     teamsCard `json:"content"`
+}
+
+type teamsCard struct {
+	Schema  string             `json:"$schema"`
+	Type    string             `json:"type"`
+	Version string             `json:"version"`
+	Body    []teamsCardElement `json:"body"`
+	MSTeams map[string]string  `json:"msteams,omitempty"`
+}
+
+// teamsCardElement is either a TextBlock or a FactSet
+type teamsCardElement struct {
+	Type   string      `json:"type"`
+	Text   string      `json:"text,omitempty"`
+	Size   string      `json:"size,omitempty"`
+	Weight string      `json:"weight,omitempty"`
+	Color  string      `json:"color,omitempty"`
+	Wrap   bool        `json:"wrap,omitempty"`
+	Facts  []teamsFact `json:"facts,omitempty"`
+}
+
+type teamsFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+func newTeamsNotifier(config adMonConfig) (notifier, error) {
+	if strings.TrimSpace(config.Teams.WebhookURL) == "" {
+		return nil, errors.New("the 'teams.webhookURL' property is empty")
+	}
+
+	return &teamsNotifier{
+		webhookURL: config.Teams.WebhookURL,
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (t *teamsNotifier) name() string {
+	return "teams"
+}
+
+func (t *teamsNotifier) notify(n notification) error {
+	return postJSON(t.client, t.webhookURL, buildTeamsMessage(n), nil)
+}
+
+func buildTeamsMessage(n notification) teamsMessage {
+	color := "Attention"
+	if n.State == alertResolved {
+		color = "Good"
+	}
+
+	body := []teamsCardElement{
+		{Type: "TextBlock", Text: n.title(), Size: "Large", Weight: "Bolder", Color: color, Wrap: true},
+		{Type: "TextBlock", Text: n.Summary(), Wrap: true},
+		{Type: "FactSet", Facts: []teamsFact{
+			{Title: "Host", Value: n.Host},
+			{Title: "APM Server IP", Value: n.APMServerIP},
+			{Title: "Severity", Value: n.severity()},
+			{Title: "Time", Value: n.Time.Format(time.RFC1123)},
+		}},
+	}
+
+	if n.Type == errorAlert {
+		body = append(body, teamsCardElement{Type: "TextBlock", Text: n.ErrorMessage, Color: color, Wrap: true})
+	} else {
+		// One fact per affected container / resource
+		facts := []teamsFact{}
+		for i, item := range n.Items {
+			title := "•"
+			if i < len(n.Keys) {
+				title = n.Keys[i]
+			}
+			facts = append(facts, teamsFact{Title: title, Value: strings.TrimSpace(item)})
+		}
+		body = append(body, teamsCardElement{Type: "FactSet", Facts: facts})
+
+		if len(n.Snoozed) > 0 {
+			snoozed := []teamsFact{}
+			for i, item := range n.Snoozed {
+				snoozed = append(snoozed, teamsFact{Title: n.SnoozedKeys[i], Value: strings.TrimSpace(item)})
+			}
+			body = append(body, teamsCardElement{Type: "TextBlock", Text: "Still failing, already notified:", Wrap: true})
+			body = append(body, teamsCardElement{Type: "FactSet", Facts: snoozed})
+		}
+	}
+
+	return teamsMessage{
+		Type: "message",
+		Attachments: []teamsAttachment{
+			{
+				ContentType: "application/vnd.microsoft.card.adaptive",
+				Content: teamsCard{
+					Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+					Type:    "AdaptiveCard",
+					Version: "1.4",
+					Body:    body,
+					MSTeams: map[string]string{"width": "Full"},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,35 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// textMailTemplate is the plain text alternative of every email
+const textMailTemplate = `{{ if .Resolved }}Admon Alert Resolved{{ else }}Admon Critical Alert!{{ end }}
+
+{{ .Summary }}
+{{ range $entry := .Entries }}
+  - {{ trim $entry.Message }}{{ end }}{{ if .Snoozed }}
+
+Still failing, already notified:{{ range $item := .Snoozed }}
+  - {{ trim $item }}{{ end }}{{ end }}{{ if .ErrorMessage }}
+  {{ .ErrorMessage }}{{ end }}
+
+Host: {{ .Hostname }}
+APM Server IP: {{ .APMServerIP }}
+Severity: {{ .Severity }}
+Time: {{ .Timestamp }}
+
+-- 
+Acceldata Admon
+`
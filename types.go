@@ -14,15 +14,64 @@
 
 package main
 
+import "regexp"
+
 type adMonConfig struct {
-	Network       string     `yaml:"network"`
-	APMServerIP   string     `yaml:"apmServerIP"`
-	Containers    []string   `yaml:"containers"`
-	SMTP          smtpConfig `yaml:"smtp"`
-	SlackTeamURL  string     `yaml:"slackTeamURL"`
-	CheckInterval int        `yaml:"CheckInterval"`
-	SnoozeTime    int        `yaml:"SnoozeTime"`
-	SysConfig     sysConfig  `yaml:"sysConfig"`
+	Network             string                        `yaml:"network"`
+	APMServerIP         string                        `yaml:"apmServerIP"`
+	Containers          []string                      `yaml:"containers"`
+	ContainerSelectors  []containerSelector           `yaml:"containerSelectors,omitempty"`
+	Channels            []string                      `yaml:"channels"`
+	Routes              []routeConfig                 `yaml:"routes,omitempty"`
+	Escalations         map[string]escalationConfig   `yaml:"escalations,omitempty"`
+	MaintenanceWindows  []maintenanceWindow           `yaml:"maintenanceWindows,omitempty"`
+	SMTP                smtpConfig                    `yaml:"smtp"`
+	Teams               teamsConfig                   `yaml:"teams,omitempty"`
+	SlackTeamURL        string                        `yaml:"slackTeamURL"`
+	PagerDuty           pagerDutyConfig               `yaml:"pagerDuty,omitempty"`
+	Webhook             webhookConfig                 `yaml:"webhook,omitempty"`
+	Alertmanager        alertmanagerConfig            `yaml:"alertmanager,omitempty"`
+	Syslog              syslogConfig                  `yaml:"syslog,omitempty"`
+	Journald            journaldConfig                `yaml:"journald,omitempty"`
+	Outbox              outboxConfig                  `yaml:"outbox,omitempty"`
+	History             historyConfig                 `yaml:"history,omitempty"`
+	CheckInterval       int                           `yaml:"CheckInterval"`
+	SnoozeTime          int                           `yaml:"SnoozeTime"`
+	EventMonitoring     bool                          `yaml:"eventMonitoring"`
+	HealthCheck         healthConfig                  `yaml:"healthCheck"`
+	RestartCheck        restartConfig                 `yaml:"restartCheck"`
+	ContainerThresholds map[string]containerThreshold `yaml:"containerThresholds,omitempty"`
+	SysConfig           sysConfig                     `yaml:"sysConfig"`
+}
+
+type containerSelector struct {
+	Name           string            `yaml:"name"`
+	Pattern        string            `yaml:"pattern,omitempty"`
+	Regex          string            `yaml:"regex,omitempty"`
+	Labels         map[string]string `yaml:"labels,omitempty"`
+	ComposeProject string            `yaml:"composeProject,omitempty"`
+	ComposeService string            `yaml:"composeService,omitempty"`
+	Replicas       int               `yaml:"replicas,omitempty"`
+	compiled       *regexp.Regexp
+}
+
+type healthConfig struct {
+	Enabled             bool `yaml:"enabled"`
+	StartingGracePeriod int  `yaml:"startingGracePeriod"`
+}
+
+type restartConfig struct {
+	Enabled     bool `yaml:"enabled"`
+	MaxRestarts int  `yaml:"maxRestarts"`
+	Window      int  `yaml:"window"`
+}
+
+type containerThreshold struct {
+	CPU           float64 `yaml:"cpu,omitempty"`
+	Memory        float64 `yaml:"memory,omitempty"`
+	Restarts      int     `yaml:"restarts,omitempty"`
+	RestartWindow int     `yaml:"restartWindow,omitempty"`
+	OOMKilled     bool    `yaml:"oomKilled,omitempty"`
 }
 
 type sysConfig struct {
@@ -35,23 +84,98 @@ type sysConfig struct {
 	SnoozeTime      int                `yaml:"SnoozeTime"`
 }
 
+type pagerDutyConfig struct {
+	RoutingKey string `yaml:"routingKey"`
+	EventsURL  string `yaml:"eventsURL,omitempty"`
+}
+
+type webhookConfig struct {
+	URL          string            `yaml:"url"`
+	Headers      map[string]string `yaml:"headers,omitempty"`
+	Secret       string            `yaml:"secret,omitempty"`
+	BodyTemplate string            `yaml:"bodyTemplate,omitempty"`
+}
+
+type teamsConfig struct {
+	WebhookURL string `yaml:"webhookURL"`
+}
+
+type alertmanagerConfig struct {
+	URL            string            `yaml:"url"`
+	Headers        map[string]string `yaml:"headers,omitempty"`
+	ResolveTimeout int               `yaml:"resolveTimeout,omitempty"`
+}
+
+type syslogConfig struct {
+	Network  string `yaml:"network,omitempty"`
+	Address  string `yaml:"address,omitempty"`
+	Facility string `yaml:"facility,omitempty"`
+	Logs     bool   `yaml:"logs"`
+}
+
+type journaldConfig struct {
+	Socket string `yaml:"socket,omitempty"`
+	Logs   bool   `yaml:"logs"`
+}
+
+type routeConfig struct {
+	Name      string     `yaml:"name,omitempty"`
+	Match     routeMatch `yaml:"match"`
+	Channels  []string   `yaml:"channels,omitempty"`
+	Receivers []string   `yaml:"receivers,omitempty"`
+	Continue  bool       `yaml:"continue,omitempty"`
+}
+
+type routeMatch struct {
+	Types       []string `yaml:"types,omitempty" json:"types,omitempty"`
+	Severities  []string `yaml:"severities,omitempty" json:"severities,omitempty"`
+	Containers  []string `yaml:"containers,omitempty" json:"containers,omitempty"`
+	Mountpoints []string `yaml:"mountpoints,omitempty" json:"mountpoints,omitempty"`
+}
+
+type maintenanceWindow struct {
+	Name     string     `yaml:"name,omitempty"`
+	Schedule string     `yaml:"schedule"`
+	Duration int        `yaml:"duration"`
+	Match    routeMatch `yaml:"match,omitempty"`
+	schedule *cronSchedule
+}
+
+type escalationConfig struct {
+	Repeat        []int    `yaml:"repeat,omitempty"`
+	EscalateAfter int      `yaml:"escalateAfter,omitempty"`
+	Channels      []string `yaml:"channels,omitempty"`
+	Receivers     []string `yaml:"receivers,omitempty"`
+}
+
+type outboxConfig struct {
+	Disabled     bool `yaml:"disabled,omitempty"`
+	RetryBackoff int  `yaml:"retryBackoff,omitempty"`
+	MaxBackoff   int  `yaml:"maxBackoff,omitempty"`
+	Expiry       int  `yaml:"expiry,omitempty"`
+}
+
+type historyConfig struct {
+	Disabled bool `yaml:"disabled,omitempty"`
+	MaxSize  int  `yaml:"maxSize,omitempty"`
+	MaxFiles int  `yaml:"maxFiles,omitempty"`
+}
+
 type smtpConfig struct {
-	Username        string   `yaml:"username"`
-	Password        string   `yaml:"password"`
-	Server          string   `yaml:"server"`
-	Port            int      `yaml:"port"`
-	SenderAddr      string   `yaml:"sender"`
-	SenderName      string   `yaml:"senderName"`
-	ReceiverAddrs   []string `yaml:"receivers"`
-	EmailSubject    string   `yaml:"emailSubject"`
-	SysAlertSubject string   `yaml:"sysAlertSubject"`
-	AuthEnabled     bool     `yaml:"authEnabled"`
-}
-
-type mailConfig struct {
-	SMTP              smtpConfig
-	MissingContainers []string
-	SlackTeamURL      string
-	APMServerIP       string
-	ErrorMessage      string
+	Username           string   `yaml:"username"`
+	Password           string   `yaml:"password"`
+	Server             string   `yaml:"server"`
+	Port               int      `yaml:"port"`
+	SenderAddr         string   `yaml:"sender"`
+	SenderName         string   `yaml:"senderName"`
+	ReceiverAddrs      []string `yaml:"receivers"`
+	EmailSubject       string   `yaml:"emailSubject"`
+	SysAlertSubject    string   `yaml:"sysAlertSubject"`
+	ResolvedSubject    string   `yaml:"resolvedSubject,omitempty"`
+	AuthEnabled        bool     `yaml:"authEnabled"`
+	AuthMechanism      string   `yaml:"authMechanism,omitempty"`
+	TLS                string   `yaml:"tls,omitempty"`
+	CAFile             string   `yaml:"caFile,omitempty"`
+	InsecureSkipVerify bool     `yaml:"insecureSkipVerify,omitempty"`
+	KeepAlive          int      `yaml:"keepAlive,omitempty"`
 }
@@ -15,19 +15,19 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"html/template"
 	"io/ioutil"
 	"net"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
-	"gopkg.in/gomail.v2"
 	"gopkg.in/yaml.v2"
 
 	"github.com/docker/docker/api/types"
@@ -35,16 +35,35 @@ import (
 	"github.com/docker/docker/client"
 )
 
-func getRunningContainers(dockerAPIVersion, containerNetwork string) ([]string, error) {
-	stack := []string{}
-	ctx := context.Background()
+func newDockerClient(dockerAPIVersion string) (*client.Client, error) {
 	cli, err := client.NewClientWithOpts(client.WithVersion(dockerAPIVersion))
 	if err != nil {
-		fmt.Println("ERROR: Failed to aquire docker API client")
+		logError("Failed to aquire docker API client")
+		return cli, err
+	}
+	return cli, nil
+}
+
+func getRunningContainers(cli *client.Client, containerNetwork string) ([]string, error) {
+	stack := []string{}
+
+	localContainers, err := listRunningContainers(cli, containerNetwork)
+	if err != nil {
 		return stack, err
 	}
+	if len(localContainers) == 0 {
+		return stack, errors.New("No existing containers found")
+	}
+
+	// Map each container to it's network stack
+	for _, container := range localContainers {
+		stack = append(stack, containerName(container))
+	}
+	return stack, nil
+}
 
-	defer cli.Close()
+func listRunningContainers(cli *client.Client, containerNetwork string) ([]types.Container, error) {
+	ctx := context.Background()
 
 	//
 	clFilters := filters.NewArgs()
@@ -59,19 +78,10 @@ func getRunningContainers(dockerAPIVersion, containerNetwork string) ([]string,
 	// Get a list of locally available containers in any states and attached to any networks
 	localContainers, err := cli.ContainerList(ctx, containerOpts)
 	if err != nil {
-		fmt.Println("ERROR: Failed to get local containers list from API")
-		return stack, err
+		logError("Failed to get local containers list from API")
+		return localContainers, err
 	}
-
-	// Map each container to it's network stack
-	if len(localContainers) != 0 {
-		for _, container := range localContainers {
-			stack = append(stack, strings.TrimPrefix(container.Names[0], "/"))
-		}
-		return stack, nil
-	}
-	err = errors.New("No existing containers found")
-	return stack, err
+	return localContainers, nil
 }
 
 func sliceDiff(a, b []string) []string {
@@ -88,68 +98,10 @@ func sliceDiff(a, b []string) []string {
 	return diff
 }
 
-func sendAlertMail(mail mailConfig) error {
-	// The email body for recipients with non-HTML email clients.
-	textBody := "This following containers are not running.\n"
-	textBody = textBody + strings.Join(mail.MissingContainers, ",")
-
-	//
-	// Create a new message.
-	m := gomail.NewMessage()
-
-	//
-	alertTemplate := template.New("alert.html")
-
-	alertTemplate, err := alertTemplate.Parse(alertMailTemplate)
-	if err != nil {
-		fmt.Println("ERROR: Cannot parse the alert email template")
-		return err
-	}
-
-	//
-	var alertMail bytes.Buffer
-	if err := alertTemplate.Execute(&alertMail, mail); err != nil {
-		fmt.Println("ERROR: Cannot execute alert email template")
-		return err
-	}
-
-	mailBody := alertMail.String()
-
-	// set the email body to html
-	m.SetBody("text/html", mailBody)
-
-	// Set the alternate email body to plain text.
-	// m.AddAlternative("text/plain", textBody)
-
-	// Construct the message headers, including a Configuration Set and a Tag.
-	m.SetHeaders(map[string][]string{
-		"From":    {m.FormatAddress(mail.SMTP.SenderAddr, mail.SMTP.SenderName)},
-		"Subject": {mail.SMTP.EmailSubject},
-	})
-
-	m.SetHeader("To", mail.SMTP.ReceiverAddrs...)
-
-	// Send the email.
-	var d *gomail.Dialer
-	if mail.SMTP.AuthEnabled {
-		d = gomail.NewPlainDialer(mail.SMTP.Server, mail.SMTP.Port, mail.SMTP.Username, mail.SMTP.Password)
-	} else {
-		d = &gomail.Dialer{Host: mail.SMTP.Server, Port: mail.SMTP.Port}
-	}
-
-	// Display an error message if something goes wrong; otherwise,
-	// display a message confirming that the message was sent.
-	if err := d.DialAndSend(m); err != nil {
-		fmt.Println("ERROR: Failed while dialing for alert mail ..")
-		return err
-	}
-	return nil
-}
-
 func readFile(fileLocation string) ([]byte, error) {
 	cfg, err := os.Open(fileLocation)
 	if err != nil {
-		fmt.Println("ERROR: Cannot open the file: ", fileLocation)
+		logError("Cannot open the file:", fileLocation)
 		return []byte(""), err
 	}
 
@@ -157,7 +109,7 @@ func readFile(fileLocation string) ([]byte, error) {
 
 	byteValue, err := ioutil.ReadAll(cfg)
 	if err != nil {
-		fmt.Println("ERROR: Cannot read the file: ", fileLocation)
+		logError("Cannot read the file:", fileLocation)
 		return []byte(""), err
 	}
 	return byteValue, nil
@@ -174,7 +126,7 @@ func parseConfig(configDir, configFileName string) (adMonConfig, error) {
 	}
 	err = yaml.Unmarshal(configFileData, &configData)
 	if err != nil {
-		fmt.Println("ERROR: Cannot unmarshal '" + configFile + "' file")
+		logError("Cannot unmarshal '" + configFile + "' file")
 		return configData, err
 	}
 	return configData, nil
@@ -185,7 +137,7 @@ func writeConfig(filePath, fileName string, fileData []byte) error {
 	file := filePath + "/" + fileName
 	// Try to write the file
 	if err := ioutil.WriteFile(file, fileData, 0o744); err != nil {
-		fmt.Println("ERROR: Failed to write the file: ", file)
+		logError("Failed to write the file:", file)
 		return err
 	}
 
@@ -199,31 +151,38 @@ func initizeAdMon(dockerAPIVersion, containerNetwork, configDir, fileName string
 	if _, err := os.Stat(configFile); os.IsNotExist(err) {
 
 		//
-		runningContainers, err := getRunningContainers(dockerAPIVersion, containerNetwork)
+		cli, err := newDockerClient(dockerAPIVersion)
 		if err != nil {
-			fmt.Println("ERROR: ", err)
+			logError(err)
+			os.Exit(1)
+		}
+
+		runningContainers, err := getRunningContainers(cli, containerNetwork)
+		cli.Close()
+		if err != nil {
+			logError(err)
 			os.Exit(1)
 		}
 
 		defaultConfig := getDefaultConfig(runningContainers, containerNetwork)
 		configData, err := yaml.Marshal(&defaultConfig)
 		if err != nil {
-			fmt.Println("ERROR: Cannot marshel config data. Because: ", err.Error())
+			logError("Cannot marshel config data. Because:", err.Error())
 			os.Exit(1)
 		}
 
 		//
 		if err := writeConfig(configDir+"/", fileName, configData); err != nil {
-			fmt.Println("ERROR: Cannot write config file. Because: ", err.Error())
+			logError("Cannot write config file. Because:", err.Error())
 			os.Exit(1)
 		}
 
 		//
-		fmt.Println("INFO: Config file initiated successfully!")
-		fmt.Printf("INFO: Edit the config file at '%s'\n", configFile)
+		logInfo("Config file initiated successfully!")
+		logInfof("Edit the config file at '%s'", configFile)
 		os.Exit(0)
 	} else if err != nil {
-		fmt.Println("ERROR: Cannot access configuration directory. Because: ", err.Error())
+		logError("Cannot access configuration directory. Because:", err.Error())
 		os.Exit(1)
 	}
 }
@@ -256,62 +215,26 @@ func getDefaultConfig(runningContainers []string, containerNetwork string) adMon
 		Network:       containerNetwork,
 		APMServerIP:   getOutboundIP().String(),
 		Containers:    runningContainers,
+		Channels:      []string{"email"},
 		SMTP:          defaultSMTPConfig,
 		SlackTeamURL:  "",
 		CheckInterval: 60,
 		SnoozeTime:    360,
-		SysConfig:     defaultSysConfig,
+		HealthCheck: healthConfig{
+			Enabled:             true,
+			StartingGracePeriod: 300,
+		},
+		RestartCheck: restartConfig{
+			Enabled:     true,
+			MaxRestarts: 3,
+			Window:      600,
+		},
+		SysConfig: defaultSysConfig,
 	}
 
 	return defaultConfig
 }
 
-func getState(configDir, fileName string, containers []string) (map[string]int64, bool, error) {
-	//
-	stateFilePath := configDir + "/" + fileName
-	containerMap := make(map[string]int64)
-	isNew := true
-
-	//
-	_, err := os.Stat(stateFilePath)
-	if os.IsNotExist(err) {
-
-		//
-		for _, containerName := range containers {
-			containerMap[containerName] = time.Now().Unix()
-		}
-
-		//
-		stateData, err := json.Marshal(containerMap)
-		if err != nil {
-			fmt.Println("ERROR: Cannot marshel container map")
-			return containerMap, isNew, err
-		}
-
-		//
-		err = ioutil.WriteFile(stateFilePath, stateData, 0o644)
-		if err != nil {
-			fmt.Println("ERROR: Cannot write the state file")
-			return containerMap, isNew, err
-		}
-		return containerMap, isNew, nil
-	} else if err != nil {
-		fmt.Printf("ERROR: Cannot check the state file at '%s'\n", stateFilePath)
-		return containerMap, false, err
-	}
-	// State file exists, Just read and return
-	isNew = false
-	stateData, err := ioutil.ReadFile(stateFilePath)
-	if err == nil {
-		if err := json.Unmarshal(stateData, &containerMap); err != nil {
-			fmt.Println("ERROR: Cannot unmarshal existing state file")
-			return containerMap, isNew, err
-		}
-		return containerMap, isNew, nil
-	}
-	return containerMap, isNew, err
-}
-
 func getCurrentState(containers []string) map[string]int64 {
 	//
 	containerMap := make(map[string]int64)
@@ -322,161 +245,134 @@ func getCurrentState(containers []string) map[string]int64 {
 	return containerMap
 }
 
-func writeState(configDir, fileName string, containerMap map[string]int64) error {
-	//
-	stateFilePath := configDir + "/" + fileName
-	//
-	stateData, err := json.Marshal(containerMap)
-	if err != nil {
-		fmt.Println("ERROR: Cannot marshel container map")
-		return err
-	}
-
-	//
-	err = ioutil.WriteFile(stateFilePath, stateData, 0o644)
-	if err != nil {
-		fmt.Println("ERROR: Cannot write the state file")
-		return err
-	}
-
-	return nil
-}
-
-func compareStates(snoozeTime int, lastState, currentState map[string]int64) (map[string]int64, bool) {
+// compareStates decides per item whether to notify: the newly failing items are notified right away and the still
+// failing ones once their next notification time of the escalation policy is reached. It returns these due items,
+// sorted, with their last notification time set. The other items keep theirs, so their snooze goes on.
+func compareStates(policy escalationPolicy, lastState map[string]itemState, currentState map[string]int64) (map[string]itemState, []string) {
 	//
-	c1diffState := make(map[string]int64)
-	l2diffState := make(map[string]int64)
-	c2diffState := make(map[string]int64)
-	updatedState := make(map[string]int64)
-	toMail := true
+	updatedState := make(map[string]itemState)
+	due := []string{}
 
 	//
-	for container, currentTime := range currentState {
-		//
-		if lastTime, ok := lastState[container]; !ok {
-			//
-			c1diffState[container] = currentTime
-		} else {
-			l2diffState[container] = lastTime
-			c2diffState[container] = currentTime
+	for item, currentTime := range currentState {
+		last, ok := lastState[item]
+		if !ok {
+			// Newly failing
+			updatedState[item] = itemState{FirstSeen: currentTime, LastNotified: currentTime}
+			due = append(due, item)
+			continue
 		}
-	}
 
-	// Check if we get any difference from last state of missing containers
-	if len(c1diffState) > 0 {
-		// New containers are missing compared to last state
-		// Merge the newly missing containers with the existing list of missing containers
-		// Send the mail
-		updatedState = mergeMaps(c1diffState, c2diffState)
-	} else {
-		// No new missing containers
-		// Now, decide whether to update the state and/or send the mail
-		var (
-			cT1 int64
-			lT1 int64
-		)
-		// Get the current time
-		for _, currentTime := range c2diffState {
-			//
-			cT1 = currentTime
-			break
+		updatedState[item] = last
+		// Check if the current time is exceeding the next notification time of the item
+		if currentTime >= policy.nextNotification(last) {
+			due = append(due, item)
 		}
+	}
+	sort.Strings(due)
 
-		// Get the last time
-		for _, lastTime := range l2diffState {
-			//
-			lT1 = lastTime
-			break
-		}
+	for _, item := range due {
+		state := updatedState[item]
+		state.LastNotified = currentState[item]
+		updatedState[item] = state
+	}
+	return updatedState, due
+}
 
-		// Check if the current time is exceeding the last time + snooze time
-		if cT1 >= (time.Unix(lT1, 0).Add(time.Duration(snoozeTime) * time.Second).Unix()) {
-			// Exceeded the snooze time
-			// Update the state with current time and send the mail
-			updatedState = c2diffState
-		} else {
-			// Within the snooze time
-			// Pass the last state as updated state and do not send the mail
-			updatedState = l2diffState
-			toMail = false
+// recoveredContainers returns the containers from the last state which are not missing anymore
+func recoveredContainers(lastState map[string]itemState, missingContainers []string) map[string]itemState {
+	recovered := make(map[string]itemState)
+	for container, state := range lastState {
+		if !containsString(missingContainers, container) {
+			recovered[container] = state
 		}
 	}
-	return updatedState, toMail
+	return recovered
 }
 
-func mergeMaps(mapOne, mapTwo map[string]int64) map[string]int64 {
-	//
-	for k, v := range mapTwo {
-		mapOne[k] = v
+// recoveryMessages describes each recovered container along with how long it was in the failed condition
+func recoveryMessages(recovered map[string]itemState, condition string) []string {
+	messages := []string{}
+	now := time.Now().Unix()
+	for _, container := range sortedKeys(recovered) {
+		outage := time.Duration(now-recovered[container].FirstSeen) * time.Second
+		messages = append(messages, fmt.Sprintf("%s - was %s for %s", container, condition, outage))
 	}
-
-	return mapOne
+	return messages
 }
 
-func sendErrorMail(mail mailConfig) error {
-	//
-	//The email body for recipients with non-HTML email clients.
-	textBody := "Somthing went wrong with the server.\n"
-	textBody = textBody + "\n" + mail.ErrorMessage
-
-	//
-	// Create a new message.
-	m := gomail.NewMessage()
-
-	//
-	errorTemplate := template.New("error.html")
-
-	errorTemplate, err := errorTemplate.Parse(errorMailTemplate)
-	if err != nil {
-		fmt.Println("ERROR: Cannot parse the error email template")
-		return err
+// firstSeenTimes returns when the items started failing, in the order of the keys
+func firstSeenTimes(states map[string]itemState, keys []string) []time.Time {
+	times := []time.Time{}
+	for _, key := range keys {
+		times = append(times, time.Unix(states[key].FirstSeen, 0))
 	}
+	return times
+}
 
-	//
-	var errorMail bytes.Buffer
-	if err := errorTemplate.Execute(&errorMail, mail); err != nil {
-		fmt.Println("ERROR: Cannot execute error email template")
-		return err
+// failingMessage marks the message of a failing item as new, or still failing since its first notification
+func failingMessage(message, condition string, state itemState, isNew bool, now int64) string {
+	if isNew {
+		return message + " [new]"
 	}
+	return fmt.Sprintf("%s [still %s for %s]", message, condition, time.Duration(now-state.FirstSeen)*time.Second)
+}
 
-	mailBody := errorMail.String()
-
-	// set the email body to html
-	m.SetBody("text/html", mailBody)
-
-	// Set the alternate email body to plain text.
-	// m.AddAlternative("text/plain", textBody)
+// failingCondition is how the items of the alert type fail, e.g. the containers are 'down'
+func failingCondition(alert alertType) string {
+	switch alert {
+	case healthAlert:
+		return "unhealthy"
+	case restartAlert:
+		return "restarting"
+	case daemonAlert:
+		return "unreachable"
+	default:
+		return "down"
+	}
+}
 
-	// Construct the message headers, including a Configuration Set and a Tag.
-	m.SetHeaders(map[string][]string{
-		"From":    {m.FormatAddress(mail.SMTP.SenderAddr, mail.SMTP.SenderName)},
-		"Subject": {mail.SMTP.EmailSubject},
-	})
+// truncateText cuts the text to at most 'max' characters, without splitting a multi-byte character
+func truncateText(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	return string([]rune(text)[:max])
+}
 
-	m.SetHeader("To", mail.SMTP.ReceiverAddrs...)
+func sortedKeys(stateMap map[string]itemState) []string {
+	keys := []string{}
+	for key := range stateMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
 
-	// Send the email.
-	var d *gomail.Dialer
-	if mail.SMTP.AuthEnabled {
-		d = gomail.NewPlainDialer(mail.SMTP.Server, mail.SMTP.Port, mail.SMTP.Username, mail.SMTP.Password)
-	} else {
-		d = &gomail.Dialer{Host: mail.SMTP.Server, Port: mail.SMTP.Port}
+// sortedNames returns the names of the failing items, sorted
+func sortedNames(items map[string]string) []string {
+	names := []string{}
+	for name := range items {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
+}
 
-	// Display an error message if something goes wrong; otherwise,
-	// display a message confirming that the message was sent.
-	if err := d.DialAndSend(m); err != nil {
-		fmt.Println("ERROR: Failed while dialing for error mail ..")
-		return err
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
 	}
-	return nil
+	return false
 }
 
 func getOutboundIP() net.IP {
 	conn, err := net.Dial("udp", "8.8.8.8:80")
 	if err != nil {
-		fmt.Println("ERROR: Cannot get the outbound IP. Because: ", err.Error())
-		fmt.Println("ERROR: Please set the outbound IP manually in the 'admon.yml' file!")
+		logError("Cannot get the outbound IP. Because:", err.Error())
+		logError("Please set the outbound IP manually in the 'admon.yml' file!")
 		return net.IPv4(0, 0, 0, 0)
 	}
 	defer conn.Close()
@@ -486,101 +382,50 @@ func getOutboundIP() net.IP {
 	return localAddr.IP
 }
 
-func getLastError(configDir, fileName string) (int64, bool, error) {
-	//
-	stateFilePath := configDir + "/tmp/" + fileName
-	timeStamp := time.Now().Unix()
-	isNew := true
-
-	//
-	_, err := os.Stat(stateFilePath)
-	if os.IsNotExist(err) {
-
-		//
-		stateData, err := json.Marshal(timeStamp)
-		if err != nil {
-			fmt.Println("ERROR: Cannot marshel container map")
-			return timeStamp, isNew, err
-		}
-
-		//
-		err = ioutil.WriteFile(stateFilePath, stateData, 0o644)
-		if err != nil {
-			fmt.Println("ERROR: Cannot write the last error state file")
-			return timeStamp, isNew, err
-		}
-		return timeStamp, isNew, nil
-	} else if err != nil {
-		fmt.Printf("ERROR: Cannot check the last error state file at '%s'\n", stateFilePath)
-		return timeStamp, false, err
-	}
-	// State file exists, Just read and return
-	isNew = false
-	stateData, err := ioutil.ReadFile(stateFilePath)
-	if err == nil {
-		if err := json.Unmarshal(stateData, &timeStamp); err != nil {
-			fmt.Println("ERROR: Cannot unmarshal existing state file")
-			return timeStamp, isNew, err
-		}
-		return timeStamp, isNew, nil
-	}
-	return timeStamp, isNew, err
-}
-
-func sendSysAlert(mail mailConfig) error {
-	// The email body for recipients with non-HTML email clients.
-	textBody := "These following system resources reached threshold.\n"
-	textBody = textBody + strings.Join(mail.MissingContainers, ",")
-
-	//
-	// Create a new message.
-	m := gomail.NewMessage()
-
-	//
-	alertTemplate := template.New("alert.html")
-
-	alertTemplate, err := alertTemplate.Parse(sysAlertMailTemplate)
+// writeFileAtomic replaces the file with a fully written and synced temporary file, so the file is never left half written
+func writeFileAtomic(filePath string, data []byte) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(filePath), "."+filepath.Base(filePath)+".*.tmp")
 	if err != nil {
-		fmt.Println("ERROR: Cannot parse the alert email template")
 		return err
 	}
+	defer os.Remove(tmpFile.Name())
 
-	//
-	var alertMail bytes.Buffer
-	if err := alertTemplate.Execute(&alertMail, mail); err != nil {
-		fmt.Println("ERROR: Cannot execute alert email template")
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
 		return err
 	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpFile.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), filePath)
+}
 
-	mailBody := alertMail.String()
-
-	// set the email body to html
-	m.SetBody("text/html", mailBody)
-
-	// Set the alternate email body to plain text.
-	// m.AddAlternative("text/plain", textBody)
-
-	// Construct the message headers, including a Configuration Set and a Tag.
-	m.SetHeaders(map[string][]string{
-		"From":    {m.FormatAddress(mail.SMTP.SenderAddr, mail.SMTP.SenderName)},
-		"Subject": {mail.SMTP.SysAlertSubject},
-	})
-
-	m.SetHeader("To", mail.SMTP.ReceiverAddrs...)
-
-	// Send the email.
-	var d *gomail.Dialer
-	if mail.SMTP.AuthEnabled {
-		d = gomail.NewPlainDialer(mail.SMTP.Server, mail.SMTP.Port, mail.SMTP.Username, mail.SMTP.Password)
-	} else {
-		d = &gomail.Dialer{Host: mail.SMTP.Server, Port: mail.SMTP.Port}
+// parseDuration accepts the Go durations, e.g. '90m', and the days, e.g. '7d'
+func parseDuration(value string) (time.Duration, error) {
+	if days := strings.TrimSuffix(value, "d"); days != value {
+		if count, err := strconv.Atoi(days); err == nil {
+			return time.Duration(count) * 24 * time.Hour, nil
+		}
 	}
+	return time.ParseDuration(value)
+}
 
-	// Display an error message if something goes wrong; otherwise,
-	// display a message confirming that the message was sent.
-	if err := d.DialAndSend(m); err != nil {
-		fmt.Println("ERROR: Failed while dialing for alert mail ..")
-		return err
+// parseDate accepts an RFC 3339 time, or a date with an optional time in the local time zone
+func parseDate(value string) (time.Time, error) {
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
 	}
-	return nil
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if parsed, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%s'. Use a date like '2006-01-02', '2006-01-02 15:04' or an RFC 3339 time", value)
 }
@@ -0,0 +1,169 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// webhookSignatureHeader carries the HMAC-SHA256 of the request body, signed with the configured secret
+const webhookSignatureHeader = "X-Admon-Signature"
+
+type webhookNotifier struct {
+	url          string
+	headers      map[string]string
+	secret       string
+	bodyTemplate *template.Template
+	client       *http.Client
+}
+
+// webhookPayload is the default JSON body and the data of the user supplied body templates
+type webhookPayload struct {
+	AlertType    string        `json:"alertType"`
+	State        string        `json:"state"`
+	Severity     string        `json:"severity"`
+	Title        string        `json:"title"`
+	Host         string        `json:"host"`
+	APMServerIP  string        `json:"apmServerIP"`
+	Items        []webhookItem `json:"items"`
+	Snoozed      []webhookItem `json:"snoozed,omitempty"`
+	ErrorMessage string        `json:"errorMessage,omitempty"`
+	Timestamp    time.Time     `json:"timestamp"`
+}
+
+// webhookItem is an item of the notification. The firstSeen, value & threshold are only set when known,
+// and the peak only for the resolved threshold based items.
+type webhookItem struct {
+	Key       string     `json:"key"`
+	Message   string     `json:"message"`
+	FirstSeen *time.Time `json:"firstSeen,omitempty"`
+	Value     string     `json:"value,omitempty"`
+	Threshold string     `json:"threshold,omitempty"`
+	Peak      string     `json:"peak,omitempty"`
+}
+
+// webhookTemplateFuncs are available in the body templates, 'json' encodes any value as JSON
+var webhookTemplateFuncs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	},
+}
+
+func newWebhookNotifier(config adMonConfig) (notifier, error) {
+	webhook := config.Webhook
+	if strings.TrimSpace(webhook.URL) == "" {
+		return nil, errors.New("the 'webhook.url' property is empty")
+	}
+
+	w := &webhookNotifier{
+		url:     webhook.URL,
+		headers: webhook.Headers,
+		secret:  webhook.Secret,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+
+	if strings.TrimSpace(webhook.BodyTemplate) != "" {
+		bodyTemplate, err := template.New("webhook").Funcs(webhookTemplateFuncs).Parse(webhook.BodyTemplate)
+		if err != nil {
+			logError("Cannot parse the 'webhook.bodyTemplate'")
+			return nil, err
+		}
+		w.bodyTemplate = bodyTemplate
+	}
+
+	return w, nil
+}
+
+func (w *webhookNotifier) name() string {
+	return "webhook"
+}
+
+func (w *webhookNotifier) notify(n notification) error {
+	payload := buildWebhookPayload(n)
+
+	var body []byte
+	if w.bodyTemplate != nil {
+		var rendered bytes.Buffer
+		if err := w.bodyTemplate.Execute(&rendered, payload); err != nil {
+			logError("Cannot execute the webhook body template")
+			return err
+		}
+		body = rendered.Bytes()
+	} else {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			logError("Cannot marshal the webhook payload")
+			return err
+		}
+		body = encoded
+	}
+
+	headers := map[string]string{}
+	for key, value := range w.headers {
+		headers[key] = value
+	}
+	if w.secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.secret))
+		mac.Write(body)
+		headers[webhookSignatureHeader] = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	return postBody(w.client, w.url, body, headers)
+}
+
+func buildWebhookPayload(n notification) webhookPayload {
+	items := []webhookItem{}
+	for i, message := range n.Items {
+		item := webhookItem{Message: strings.TrimSpace(message)}
+		if i < len(n.Keys) {
+			item.Key = n.Keys[i]
+		}
+		if i < len(n.FirstSeen) && n.FirstSeen[i].Unix() > 0 {
+			firstSeen := n.FirstSeen[i].UTC()
+			item.FirstSeen = &firstSeen
+		}
+		if i < len(n.Values) {
+			item.Value, item.Threshold, item.Peak = n.Values[i].Value, n.Values[i].Threshold, n.Values[i].Peak
+		}
+		items = append(items, item)
+	}
+	snoozed := []webhookItem{}
+	for i, message := range n.Snoozed {
+		snoozed = append(snoozed, webhookItem{Key: n.SnoozedKeys[i], Message: strings.TrimSpace(message)})
+	}
+
+	return webhookPayload{
+		AlertType:    string(n.Type),
+		State:        string(n.State),
+		Severity:     n.severity(),
+		Title:        n.title(),
+		Host:         n.Host,
+		APMServerIP:  n.APMServerIP,
+		Items:        items,
+		Snoozed:      snoozed,
+		ErrorMessage: n.ErrorMessage,
+		Timestamp:    n.Time.UTC(),
+	}
+}
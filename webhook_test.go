@@ -0,0 +1,105 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookNotify(t *testing.T) {
+	n := notification{
+		Type:      systemAlert,
+		State:     alertFiring,
+		Host:      "node1",
+		Keys:      []string{"cpu"},
+		Items:     []string{"CPU usage is 95%"},
+		Values:    []itemValue{{Value: "95%", Threshold: "90%"}},
+		FirstSeen: []time.Time{time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)},
+		Time:      time.Date(2024, 6, 1, 10, 5, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		name          string
+		config        webhookConfig
+		wantBody      string
+		wantSignature bool
+	}{
+		{
+			name:     "default payload",
+			config:   webhookConfig{},
+			wantBody: `{"alertType":"system","state":"firing","severity":"warning","title":"Server Resources Reached Threshold","host":"node1","apmServerIP":"","items":[{"key":"cpu","message":"CPU usage is 95%","firstSeen":"2024-06-01T10:00:00Z","value":"95%","threshold":"90%"}],"timestamp":"2024-06-01T10:05:00Z"}`,
+		},
+		{
+			name:          "signed payload",
+			config:        webhookConfig{Secret: "change-me"},
+			wantSignature: true,
+		},
+		{
+			name:          "signed body template",
+			config:        webhookConfig{Secret: "change-me", BodyTemplate: `{"summary": {{ printf "%s on %s" .Title .Host | json }}, "value": {{ (index .Items 0).Value | json }}}`},
+			wantBody:      `{"summary": "Server Resources Reached Threshold on node1", "value": "95%"}`,
+			wantSignature: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var body []byte
+			var headers http.Header
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ = ioutil.ReadAll(r.Body)
+				headers = r.Header
+			}))
+			defer server.Close()
+
+			test.config.URL = server.URL
+			test.config.Headers = map[string]string{"Authorization": "Bearer XXXX"}
+			w, err := newWebhookNotifier(adMonConfig{Webhook: test.config})
+			if err != nil {
+				t.Fatalf("newWebhookNotifier() returned the error: %s", err)
+			}
+			if err := w.notify(n); err != nil {
+				t.Fatalf("notify() returned the error: %s", err)
+			}
+
+			if test.wantBody != "" && string(body) != test.wantBody {
+				t.Errorf("body = %s, want %s", body, test.wantBody)
+			}
+			if got := headers.Get("Authorization"); got != "Bearer XXXX" {
+				t.Errorf("Authorization header = %q, want the custom header", got)
+			}
+
+			signature := headers.Get(webhookSignatureHeader)
+			if !test.wantSignature {
+				if signature != "" {
+					t.Errorf("%s header = %q, want none", webhookSignatureHeader, signature)
+				}
+				return
+			}
+			mac := hmac.New(sha256.New, []byte(test.config.Secret))
+			mac.Write(body)
+			if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); signature != want {
+				t.Errorf("%s header = %q, want %q", webhookSignatureHeader, signature, want)
+			}
+		})
+	}
+}